@@ -0,0 +1,233 @@
+package httpzip
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatTarZst is a tar archive compressed with Zstandard, it can only be read if decompressor is registered
+// for Zstd method with RegisterDecompressor.
+const FormatTarZst = Format("tar.zst")
+
+// DetectFormat peeks at the first bytes of archive and detects its format,
+// returned reader has the same data as r.
+func DetectFormat(r io.Reader) (Format, io.Reader, error) {
+	br := bufio.NewReaderSize(r, 2*tarBlockSize)
+
+	b, err := br.Peek(tarBlockSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", br, err
+	}
+
+	switch {
+	case bytes.HasPrefix(b, []byte("PK\x03\x04")), bytes.HasPrefix(b, []byte("PK\x05\x06")):
+		return FormatZip, br, nil
+	case bytes.HasPrefix(b, []byte{0x1f, 0x8b}):
+		return FormatTarGz, br, nil
+	case bytes.HasPrefix(b, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return FormatTarZst, br, nil
+	case isTarHeader(b):
+		return FormatTar, br, nil
+	default:
+		return "", br, ErrUnsupportedFormat
+	}
+}
+
+// isTarHeader checks magic of POSIX tar or checksum of pre-POSIX tar header,
+// zero block of empty archive is also accepted.
+func isTarHeader(b []byte) bool {
+	if len(b) < tarBlockSize {
+		return false
+	}
+
+	if bytes.Count(b[:tarBlockSize], []byte{0}) == tarBlockSize {
+		return true
+	}
+
+	if string(b[257:262]) == "ustar" {
+		return true
+	}
+
+	chksum, err := strconv.ParseUint(strings.Trim(string(b[148:156]), " \x00"), 8, 64)
+	if err != nil {
+		return false
+	}
+
+	// Checksum is a sum of header bytes with checksum field filled with spaces.
+	var sum uint64
+
+	for i, c := range b[:tarBlockSize] {
+		if i >= 148 && i < 156 {
+			c = ' '
+		}
+
+		sum += uint64(c)
+	}
+
+	return sum == chksum
+}
+
+// ArchiveReader reads entries of ZIP, tar, tar.gz or tar.zst stream with a common iterator.
+type ArchiveReader struct {
+	format Format
+	zip    *StreamReader
+	tar    *tar.Reader
+	closer io.Closer
+}
+
+// NewArchiveReader detects archive format and creates a reader.
+func NewArchiveReader(r io.Reader) (*ArchiveReader, error) {
+	format, r, err := DetectFormat(r)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &ArchiveReader{format: format}
+
+	switch format {
+	case FormatZip:
+		a.zip = NewStreamReader(r)
+	case FormatTarGz:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+
+		a.tar = tar.NewReader(gr)
+		a.closer = gr
+	case FormatTarZst:
+		dcomp := decompressor(Zstd)
+		if dcomp == nil {
+			return nil, fmt.Errorf("%w: %s needs decompressor for method %d", ErrUnsupportedFormat, format, Zstd)
+		}
+
+		rc := dcomp(r)
+		a.tar = tar.NewReader(rc)
+		a.closer = rc
+	default:
+		a.tar = tar.NewReader(r)
+	}
+
+	return a, nil
+}
+
+// Format returns detected format.
+func (a *ArchiveReader) Format() Format {
+	return a.format
+}
+
+// StreamReader returns underlying reader of ZIP archive, for example to set Password or Limits,
+// it is nil for tar archives.
+func (a *ArchiveReader) StreamReader() *StreamReader {
+	return a.zip
+}
+
+// ArchiveEntry is a file, directory or symlink of archive.
+type ArchiveEntry struct {
+	Name     string
+	Size     int64 // Uncompressed size, -1 if it is unknown until the end of data.
+	Mode     fs.FileMode
+	Modified time.Time
+	Linkname string // Symlink target of tar entry, ZIP symlink has target as data.
+
+	Zip *Entry      // ZIP entry, nil for tar archives.
+	Tar *tar.Header // Tar header, nil for ZIP archives.
+
+	tr *tar.Reader
+}
+
+// IsDir checks if entry is a directory.
+func (e *ArchiveEntry) IsDir() bool {
+	return e.Mode.IsDir()
+}
+
+// Open returns entry data, it is only valid until the next entry.
+func (e *ArchiveEntry) Open() (io.ReadCloser, error) {
+	if e.Zip != nil {
+		return e.Zip.Open()
+	}
+
+	return io.NopCloser(e.tr), nil
+}
+
+// Next returns the next entry, io.EOF is returned at the end of archive.
+func (a *ArchiveReader) Next() (*ArchiveEntry, error) {
+	if a.zip != nil {
+		e, err := a.zip.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		ae := &ArchiveEntry{
+			Name:     e.Name,
+			Size:     int64(e.UncompressedSize64),
+			Mode:     e.Mode(),
+			Modified: e.Modified,
+			Zip:      e,
+		}
+
+		if e.unknownSize {
+			ae.Size = -1
+		}
+
+		return ae, nil
+	}
+
+	hdr, err := a.tar.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ArchiveEntry{
+		Name:     hdr.Name,
+		Size:     hdr.Size,
+		Mode:     hdr.FileInfo().Mode(),
+		Modified: hdr.ModTime,
+		Linkname: hdr.Linkname,
+		Tar:      hdr,
+		tr:       a.tar,
+	}, nil
+}
+
+// All returns iterator over remaining entries, iteration ends after the first error.
+//
+// Entry is only valid until the next iteration.
+func (a *ArchiveReader) All() iter.Seq2[*ArchiveEntry, error] {
+	return func(yield func(*ArchiveEntry, error) bool) {
+		for {
+			e, err := a.Next()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+
+			if err != nil {
+				yield(nil, err)
+
+				return
+			}
+
+			if !yield(e, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Close releases decompressor of tar archive, underlying reader is not closed.
+func (a *ArchiveReader) Close() error {
+	if a.closer != nil {
+		return a.closer.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package httpzip_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+
+	"github.com/vearutop/httpzip"
+)
+
+func TestNewArchiveReader(t *testing.T) {
+	zipArchive, zipContents := mixedArchive(t)
+	tarArchive := tarFiles(t)
+
+	gz := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(gz)
+	_, _ = gw.Write(tarArchive)
+	_ = gw.Close()
+
+	// Fake Zstandard frame: magic bytes followed by uncompressed data.
+	zst := append([]byte{0x28, 0xb5, 0x2f, 0xfd}, tarArchive...)
+
+	if _, err := httpzip.NewArchiveReader(bytes.NewReader(zst)); !errors.Is(err, httpzip.ErrUnsupportedFormat) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	httpzip.RegisterDecompressor(httpzip.Zstd, func(r io.Reader) io.ReadCloser {
+		_, _ = io.CopyN(io.Discard, r, 4)
+
+		return io.NopCloser(r)
+	})
+	t.Cleanup(func() {
+		httpzip.RegisterDecompressor(httpzip.Zstd, nil)
+	})
+
+	tarContents := map[string]string{"dir/": "", "dir/a.sh": "hhhhhhhhh", "dir/link": "", "dir/hard": "", "b.txt": "ttttt"}
+
+	for _, tc := range []struct {
+		format   httpzip.Format
+		archive  []byte
+		contents map[string]string
+	}{
+		{format: httpzip.FormatZip, archive: zipArchive, contents: zipContents},
+		{format: httpzip.FormatTar, archive: tarArchive, contents: tarContents},
+		{format: httpzip.FormatTarGz, archive: gz.Bytes(), contents: tarContents},
+		{format: httpzip.FormatTarZst, archive: zst, contents: tarContents},
+	} {
+		t.Run(string(tc.format), func(t *testing.T) {
+			a, err := httpzip.NewArchiveReader(bytes.NewReader(tc.archive))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if a.Format() != tc.format {
+				t.Fatalf("unexpected format: %s", a.Format())
+			}
+
+			found := map[string]string{}
+
+			for e, err := range a.All() {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				rc, err := e.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				c, err := io.ReadAll(rc)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if e.Size >= 0 && e.Size != int64(len(c)) {
+					t.Fatalf("unexpected size of %s: %d", e.Name, e.Size)
+				}
+
+				switch e.Name {
+				case "dir/":
+					if !e.IsDir() || e.Mode.Perm() != 0o750 {
+						t.Fatalf("unexpected mode of %s: %s", e.Name, e.Mode)
+					}
+				case "dir/link":
+					if e.Mode&fs.ModeSymlink == 0 || e.Linkname != "a.sh" {
+						t.Fatalf("unexpected symlink: %s, %s", e.Mode, e.Linkname)
+					}
+				case "deflate-dd.txt":
+					if e.Size != -1 || e.Zip == nil {
+						t.Fatal("unknown size expected")
+					}
+				}
+
+				found[e.Name] = string(c)
+			}
+
+			if len(found) != len(tc.contents) {
+				t.Fatalf("unexpected entries: %d", len(found))
+			}
+
+			for name, c := range tc.contents {
+				if found[name] != c {
+					t.Fatalf("unexpected contents of %s: %q", name, found[name])
+				}
+			}
+
+			if err := a.Close(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	if _, err := httpzip.NewArchiveReader(bytes.NewReader([]byte("not an archive"))); !errors.Is(err, httpzip.ErrUnsupportedFormat) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestNewArchiveReader_emptyTar(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	_ = tar.NewWriter(buf).Close()
+
+	a, err := httpzip.NewArchiveReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Format() != httpzip.FormatTar {
+		t.Fatalf("unexpected format: %s", a.Format())
+	}
+
+	if _, err := a.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	h := httpzip.NewHandler("empty")
+
+	if err := h.AddTar(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
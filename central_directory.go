@@ -0,0 +1,383 @@
+package httpzip
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	directoryHeaderLen  = 42 // Without signature.
+	directoryEndLen     = 18 // Without signature.
+	directory64LocLen   = 16 // Without signature.
+	directory64EndLen   = 52 // Without signature and variable data.
+	directory64EndSizes = 8  // Size of record size field.
+)
+
+// CentralDirectory contains records that follow local entries.
+type CentralDirectory struct {
+	Files   []DirectoryFile
+	Comment string // Archive comment.
+
+	Offset     int64  // Position of the first central directory header in the stream.
+	Size       uint64 // Size of central directory, as read from the stream.
+	EndRecords bool   // End of central directory record was found.
+
+	// Values from end of central directory record, or from Zip64 record if available.
+	RecordedEntries uint64
+	RecordedOffset  uint64
+	RecordedSize    uint64
+}
+
+// DirectoryFile is a file header from central directory.
+type DirectoryFile struct {
+	zip.FileHeader
+
+	// HeaderOffset is a recorded position of local file header.
+	HeaderOffset uint64
+}
+
+// Mismatch describes a difference between central directory and local entries.
+type Mismatch struct {
+	Field   string
+	Local   string
+	Central string
+
+	// Entry is a local entry, or nil if central directory file has no local entry.
+	Entry *Entry
+
+	// File is a central directory file, or nil if local entry is missing in central directory.
+	File *DirectoryFile
+}
+
+func (m Mismatch) String() string {
+	name := ""
+
+	switch {
+	case m.Entry != nil:
+		name = m.Entry.Name
+	case m.File != nil:
+		name = m.File.Name
+	}
+
+	return fmt.Sprintf("%s %q: local %s, central %s", m.Field, name, m.Local, m.Central)
+}
+
+// ValidationError is returned when central directory does not match local entries.
+type ValidationError struct {
+	Mismatches []Mismatch
+}
+
+func (v *ValidationError) Error() string {
+	s := make([]string, 0, len(v.Mismatches))
+	for _, m := range v.Mismatches {
+		s = append(s, m.String())
+	}
+
+	return fmt.Sprintf("central directory does not match local entries: %s", strings.Join(s, "; "))
+}
+
+// CentralDirectory returns central directory if it was read after the last local entry.
+func (z *StreamReader) CentralDirectory() *CentralDirectory {
+	return z.directory
+}
+
+// readSignature returns offset and value of the next record signature.
+func (z *StreamReader) readSignature() (int64, uint32, error) {
+	var buf [headerIdentifierLen]byte
+
+	offset := z.r.n
+
+	if _, err := io.ReadFull(z.r, buf[:]); err != nil {
+		return offset, 0, readError(offset, "", RecordSignature, err)
+	}
+
+	return offset, binary.LittleEndian.Uint32(buf[:]), nil
+}
+
+func (z *StreamReader) readCentralDirectory(sig uint32) error {
+	cd := &CentralDirectory{Offset: z.r.n - headerIdentifierLen}
+	z.directory = cd
+
+	var err error
+
+	// Offset of the current record, including its signature.
+	start := cd.Offset
+
+	for sig == directoryHeaderSignature {
+		f, err := z.readDirectoryFile()
+		if err != nil {
+			return readError(start, "", RecordCentralDirectory, err)
+		}
+
+		cd.Files = append(cd.Files, f)
+
+		if start, sig, err = z.readSignature(); err != nil {
+			return err
+		}
+	}
+
+	cd.Size = uint64(start - cd.Offset)
+
+	if sig == directory64EndSignature {
+		if err := z.readDirectory64End(cd); err != nil {
+			return readError(start, "", RecordDirectory64End, err)
+		}
+
+		if start, sig, err = z.readSignature(); err != nil {
+			return err
+		}
+	}
+
+	if sig == directory64LocSignature {
+		if _, err := io.CopyN(io.Discard, z.r, directory64LocLen); err != nil {
+			return readError(start, "", RecordDirectory64Locator, err)
+		}
+
+		if start, sig, err = z.readSignature(); err != nil {
+			return err
+		}
+	}
+
+	if sig != directoryEndSignature {
+		return &FormatError{
+			Offset: start,
+			Record: RecordSignature,
+			Err:    fmt.Errorf("unexpected signature %#08x", sig),
+		}
+	}
+
+	if err := z.readDirectoryEnd(cd); err != nil {
+		return readError(start, "", RecordDirectoryEnd, err)
+	}
+
+	return z.validateDirectory()
+}
+
+func (z *StreamReader) readDirectoryFile() (DirectoryFile, error) {
+	var (
+		f   DirectoryFile
+		buf [directoryHeaderLen]byte
+	)
+
+	if _, err := io.ReadFull(z.r, buf[:]); err != nil {
+		return f, err
+	}
+
+	b := readBuf(buf[:])
+	f.CreatorVersion = b.uint16()
+	f.ReaderVersion = b.uint16()
+	f.Flags = b.uint16()
+	f.Method = b.uint16()
+	f.ModifiedTime = b.uint16()
+	f.ModifiedDate = b.uint16()
+	f.CRC32 = b.uint32()
+	f.CompressedSize = b.uint32()
+	f.UncompressedSize = b.uint32()
+	f.CompressedSize64 = uint64(f.CompressedSize)
+	f.UncompressedSize64 = uint64(f.UncompressedSize)
+	filenameLen := int(b.uint16())
+	extraLen := int(b.uint16())
+	commentLen := int(b.uint16())
+	b = b[4:] // Skipped start disk number and internal attributes (2x uint16).
+	f.ExternalAttrs = b.uint32()
+	f.HeaderOffset = uint64(b.uint32())
+	f.Modified = msDosTimeToTime(f.ModifiedDate, f.ModifiedTime)
+
+	d := make([]byte, filenameLen+extraLen+commentLen)
+	if _, err := io.ReadFull(z.r, d); err != nil {
+		return f, err
+	}
+
+	f.Extra = d[filenameLen : filenameLen+extraLen]
+	f.Name = z.decodeText(d[:filenameLen], f.Flags, f.Extra, UnicodePathExtraID)
+	f.Comment = z.decodeText(d[filenameLen+extraLen:], f.Flags, f.Extra, UnicodeCommentExtraID)
+	f.NonUTF8 = f.Flags&flagUTF8 == 0
+
+	needUSize := f.UncompressedSize == ^uint32(0)
+	needCSize := f.CompressedSize == ^uint32(0)
+	needHeaderOffset := f.HeaderOffset == uint64(^uint32(0))
+
+	for extra := readBuf(f.Extra); len(extra) >= 4; {
+		fieldTag := extra.uint16()
+		fieldSize := int(extra.uint16())
+
+		if len(extra) < fieldSize {
+			break
+		}
+
+		fieldBuf := extra.sub(fieldSize)
+		if fieldTag != Zip64ExtraID {
+			continue
+		}
+
+		// Zip64 values are only present for fields that are maxed out.
+		if needUSize && len(fieldBuf) >= 8 {
+			f.UncompressedSize64 = fieldBuf.uint64()
+		}
+
+		if needCSize && len(fieldBuf) >= 8 {
+			f.CompressedSize64 = fieldBuf.uint64()
+		}
+
+		if needHeaderOffset && len(fieldBuf) >= 8 {
+			f.HeaderOffset = fieldBuf.uint64()
+		}
+	}
+
+	return f, nil
+}
+
+func (z *StreamReader) readDirectory64End(cd *CentralDirectory) error {
+	var buf [directory64EndLen]byte
+
+	if _, err := io.ReadFull(z.r, buf[:]); err != nil {
+		return err
+	}
+
+	b := readBuf(buf[:])
+	size := b.uint64() // Size of the rest of the record.
+	b = b[12:]         // Skipped versions (2x uint16) and disk numbers (2x uint32).
+	b.uint64()         // Number of entries on this disk.
+	cd.RecordedEntries = b.uint64()
+	cd.RecordedSize = b.uint64()
+	cd.RecordedOffset = b.uint64()
+
+	// Extensible data sector is skipped.
+	if size > directory64EndLen-directory64EndSizes {
+		if _, err := io.CopyN(io.Discard, z.r, int64(size-(directory64EndLen-directory64EndSizes))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (z *StreamReader) readDirectoryEnd(cd *CentralDirectory) error {
+	var buf [directoryEndLen]byte
+
+	if _, err := io.ReadFull(z.r, buf[:]); err != nil {
+		return err
+	}
+
+	b := readBuf(buf[:])
+	b = b[6:] // Skipped disk numbers and number of entries on this disk (3x uint16).
+	entries := uint64(b.uint16())
+	size := uint64(b.uint32())
+	offset := uint64(b.uint32())
+	commentLen := int(b.uint16())
+
+	// Zip64 record values are used if legacy values are maxed out.
+	if entries != 0xffff || cd.RecordedEntries == 0 {
+		cd.RecordedEntries = entries
+	}
+
+	if size != uint64(^uint32(0)) || cd.RecordedSize == 0 {
+		cd.RecordedSize = size
+	}
+
+	if offset != uint64(^uint32(0)) || cd.RecordedOffset == 0 {
+		cd.RecordedOffset = offset
+	}
+
+	comment := make([]byte, commentLen)
+	if _, err := io.ReadFull(z.r, comment); err != nil {
+		return err
+	}
+
+	cd.Comment = string(comment)
+	cd.EndRecords = true
+
+	return nil
+}
+
+// validateDirectory checks central directory against local entries and fills
+// external attributes and comments of local entries.
+func (z *StreamReader) validateDirectory() error {
+	cd := z.directory
+	byOffset := make(map[int64]*Entry, len(z.entries))
+	seen := make(map[*Entry]bool, len(z.entries))
+
+	var mm []Mismatch
+
+	for _, e := range z.entries {
+		byOffset[e.headerOffset] = e
+	}
+
+	add := func(field string, local, central any, e *Entry, f *DirectoryFile) {
+		mm = append(mm, Mismatch{
+			Field:   field,
+			Local:   fmt.Sprint(local),
+			Central: fmt.Sprint(central),
+			Entry:   e,
+			File:    f,
+		})
+	}
+
+	if cd.RecordedEntries != uint64(len(cd.Files)) {
+		add("entries count", len(cd.Files), cd.RecordedEntries, nil, nil)
+	}
+
+	if cd.RecordedSize != cd.Size {
+		add("directory size", cd.Size, cd.RecordedSize, nil, nil)
+	}
+
+	if cd.RecordedOffset != uint64(cd.Offset) {
+		add("directory offset", cd.Offset, cd.RecordedOffset, nil, nil)
+	}
+
+	for i := range cd.Files {
+		f := &cd.Files[i]
+
+		e := byOffset[int64(f.HeaderOffset)]
+		if e == nil || seen[e] {
+			add("local entry", "missing", f.HeaderOffset, nil, f)
+
+			continue
+		}
+
+		seen[e] = true
+
+		if e.Name != f.Name {
+			add("name", e.Name, f.Name, e, f)
+		}
+
+		if e.Method != f.Method {
+			add("method", e.Method, f.Method, e, f)
+		}
+
+		if e.Flags&1 != f.Flags&1 {
+			add("encryption", e.Flags&1 != 0, f.Flags&1 != 0, e, f)
+		}
+
+		if e.CRC32 != f.CRC32 {
+			add("crc32", e.CRC32, f.CRC32, e, f)
+		}
+
+		if e.CompressedSize64 != f.CompressedSize64 {
+			add("compressed size", e.CompressedSize64, f.CompressedSize64, e, f)
+		}
+
+		if e.UncompressedSize64 != f.UncompressedSize64 {
+			add("uncompressed size", e.UncompressedSize64, f.UncompressedSize64, e, f)
+		}
+
+		e.CreatorVersion = f.CreatorVersion
+		e.ExternalAttrs = f.ExternalAttrs
+		e.Comment = f.Comment
+	}
+
+	for _, e := range z.entries {
+		if !seen[e] {
+			add("central directory file", e.headerOffset, "missing", e, nil)
+		}
+	}
+
+	if len(mm) > 0 {
+		return &ValidationError{Mismatches: mm}
+	}
+
+	return nil
+}
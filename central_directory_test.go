@@ -0,0 +1,96 @@
+package httpzip_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/vearutop/httpzip"
+)
+
+func centralDirectoryArchive(t *testing.T) []byte {
+	t.Helper()
+
+	var entries []zipEntry
+
+	for _, name := range []string{"a.txt", "b.txt", "dir/"} {
+		e := zipEntry{name: name, method: zip.Deflate, comment: "comment " + name, mode: 0o640}
+		if name != "dir/" {
+			e.data = []byte("hello " + name)
+		}
+
+		entries = append(entries, e)
+	}
+
+	return zipArchiveComment(t, "archive comment", entries...)
+}
+
+func readAll(sr *httpzip.StreamReader) ([]*httpzip.Entry, error) {
+	var entries []*httpzip.Entry
+
+	for {
+		e, err := sr.Next()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+
+		if err != nil {
+			return entries, err
+		}
+
+		entries = append(entries, e)
+	}
+}
+
+func TestStreamReader_ReadCentralDirectory(t *testing.T) {
+	sr := httpzip.NewStreamReader(bytes.NewReader(centralDirectoryArchive(t)))
+	sr.ReadCentralDirectory = true
+
+	entries, err := readAll(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cd := sr.CentralDirectory()
+	if cd == nil || len(cd.Files) != 3 || cd.Comment != "archive comment" {
+		t.Fatalf("unexpected central directory: %+v", cd)
+	}
+
+	for _, e := range entries {
+		if e.Comment != "comment "+e.Name {
+			t.Fatalf("unexpected comment %q for %s", e.Comment, e.Name)
+		}
+
+		if e.Mode().Perm() != 0o640 {
+			t.Fatalf("unexpected mode %s for %s", e.Mode(), e.Name)
+		}
+	}
+}
+
+func TestStreamReader_ReadCentralDirectory_mismatch(t *testing.T) {
+	data := centralDirectoryArchive(t)
+
+	// Rename file in central directory, name is followed by comment.
+	i := bytes.LastIndex(data, []byte("b.txtcomment"))
+	data[i] = 'x'
+
+	sr := httpzip.NewStreamReader(bytes.NewReader(data))
+	sr.ReadCentralDirectory = true
+
+	_, err := readAll(sr)
+
+	var ve *httpzip.ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(ve.Mismatches) != 1 || ve.Mismatches[0].Field != "name" || ve.Mismatches[0].Central != "x.txt" {
+		t.Fatalf("unexpected mismatches: %v", ve)
+	}
+
+	if _, err := sr.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
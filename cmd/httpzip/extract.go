@@ -0,0 +1,266 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/vearutop/httpzip"
+)
+
+// Overwrite policies.
+var overwritePolicies = map[string]httpzip.ConflictPolicy{
+	"error":  httpzip.ConflictError,
+	"skip":   httpzip.ConflictSkip,
+	"always": httpzip.ConflictOverwrite,
+	"rename": httpzip.ConflictRename,
+}
+
+// exitCodeChecksum is returned when an entry failed CRC32 validation.
+const exitCodeChecksum = 3
+
+type globs []string
+
+func (g *globs) String() string {
+	return strings.Join(*g, ",")
+}
+
+func (g *globs) Set(v string) error {
+	if _, err := path.Match(v, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", v, err)
+	}
+
+	*g = append(*g, v)
+
+	return nil
+}
+
+func extract(args []string) error {
+	fl := flag.NewFlagSet("extract", flag.ExitOnError)
+	fl.Usage = func() {
+		fmt.Fprintln(fl.Output(), "Usage: httpzip extract [flags] <url|file|->")
+		fmt.Fprintln(fl.Output(), "Extracts ZIP stream as it arrives, use - to read from STDIN.")
+		fl.PrintDefaults()
+	}
+
+	var include, exclude globs
+
+	out := fl.String("o", ".", "output directory")
+	overwrite := fl.String("overwrite", "error", "policy for existing files: error, skip, always, rename")
+	fl.Var(&include, "include", "glob of entries to extract, can be repeated")
+	fl.Var(&exclude, "exclude", "glob of entries to skip, can be repeated")
+	verbose := fl.Bool("v", false, "print extracted file names")
+	progress := fl.Bool("progress", true, "show progress on STDERR")
+	password := fl.String("password", "", "password for encrypted entries")
+	fsync := fl.Bool("fsync", false, "sync extracted files to storage")
+	strict := fl.Bool("strict", false, "fail on entries without CRC32")
+	skipJunk := fl.Bool("skip-junk", false, "skip __MACOSX/ and .DS_Store entries")
+	maxEntries := fl.Int("max-entries", 0, "maximum number of entries, 0 for no limit")
+	maxSize := fl.Uint64("max-size", 0, "maximum total uncompressed size in bytes, 0 for no limit")
+	maxRatio := fl.Float64("max-ratio", 0, "maximum compression ratio of an entry, 0 for no limit")
+
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+
+	policy, ok := overwritePolicies[*overwrite]
+	if !ok {
+		return fmt.Errorf("unknown overwrite policy %q", *overwrite)
+	}
+
+	if fl.NArg() != 1 {
+		fl.Usage()
+
+		return errors.New("exactly one source expected")
+	}
+
+	src, total, err := openSource(fl.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer src.Close() //nolint:errcheck
+
+	cr := &progressReader{r: src}
+
+	if *progress {
+		stop := cr.report(total)
+		defer stop()
+	}
+
+	zr := httpzip.NewStreamReader(cr)
+	zr.Password = passwordFunc(*password)
+	zr.StrictChecksum = *strict
+	zr.Limits = httpzip.Limits{
+		MaxEntries:          *maxEntries,
+		MaxTotalSize:        *maxSize,
+		MaxCompressionRatio: *maxRatio,
+	}
+
+	crcErrors := 0
+
+	report, err := zr.Extract(*out, httpzip.ExtractOptions{
+		Conflict: policy,
+		Fsync:    *fsync,
+		Filter:   httpzip.WalkOptions{Include: include, Exclude: exclude, SkipJunk: *skipJunk}.Match,
+		OnError: func(_ *httpzip.Entry, err error) error {
+			// Other entries are still extracted, command fails at the end.
+			if !errors.Is(err, zip.ErrChecksum) {
+				return err
+			}
+
+			crcErrors++
+
+			fmt.Fprintln(os.Stderr, err)
+
+			return nil
+		},
+	})
+
+	if *verbose && report != nil {
+		for _, f := range report.Files {
+			switch {
+			case f.Skipped:
+				fmt.Fprintln(os.Stderr, "skipped:", f.Path)
+			case !f.Dir:
+				fmt.Fprintln(os.Stderr, f.Path)
+			}
+		}
+	}
+
+	if errors.Is(err, zip.ErrChecksum) {
+		return exitError{code: exitCodeChecksum, err: err}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if crcErrors > 0 {
+		return exitError{
+			code: exitCodeChecksum,
+			err:  fmt.Errorf("%d entries failed checksum validation", crcErrors),
+		}
+	}
+
+	return nil
+}
+
+// openSource opens URL, file or STDIN and returns reader with its length, or -1 if length is unknown.
+func openSource(src string) (io.ReadCloser, int64, error) {
+	if src == "-" {
+		return io.NopCloser(os.Stdin), -1, nil
+	}
+
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		resp, err := http.Get(src) //nolint:noctx // CLI has no context to propagate.
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			_ = resp.Body.Close()
+
+			return nil, 0, fmt.Errorf("unexpected response status: %s", resp.Status)
+		}
+
+		return resp.Body, resp.ContentLength, nil
+	}
+
+	f, err := os.Open(src) //nolint:gosec // File name comes from user input intentionally.
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := int64(-1)
+	if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+		total = fi.Size()
+	}
+
+	return f, total, nil
+}
+
+// progressReader counts bytes read from the source.
+type progressReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.n.Add(int64(n))
+
+	return n, err
+}
+
+// report periodically prints progress to STDERR until returned function is called.
+func (p *progressReader) report(total int64) func() {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	show := func() {
+		n := p.n.Load()
+		if total > 0 {
+			fmt.Fprintf(os.Stderr, "\r%s / %s (%.1f%%)", byteSize(n), byteSize(total), 100*float64(n)/float64(total))
+		} else {
+			fmt.Fprintf(os.Stderr, "\r%s", byteSize(n))
+		}
+	}
+
+	go func() {
+		defer close(finished)
+
+		t := time.NewTicker(500 * time.Millisecond)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				show()
+			case <-done:
+				show()
+				fmt.Fprintln(os.Stderr)
+
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+func byteSize(n int64) string {
+	const unit = 1024
+
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func passwordFunc(password string) func(e *httpzip.Entry) (string, error) {
+	return func(e *httpzip.Entry) (string, error) {
+		if password == "" {
+			return "", fmt.Errorf("%s: %w", e.Name, httpzip.ErrPasswordRequired)
+		}
+
+		return password, nil
+	}
+}
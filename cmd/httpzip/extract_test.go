@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vearutop/httpzip"
+)
+
+type testFile struct {
+	name    string
+	content string
+	corrupt bool // CRC32 does not match data.
+}
+
+// testZip creates archive with sizes and CRC32 in local headers.
+func testZip(t *testing.T, files ...testFile) []byte {
+	t.Helper()
+
+	h := httpzip.NewHandler("test")
+	h.Streamable = true
+
+	for _, f := range files {
+		sum := crc32.ChecksumIEEE([]byte(f.content))
+		if f.corrupt {
+			sum = ^sum
+		}
+
+		if err := h.AddFile(httpzip.FileSource{
+			Path:  f.name,
+			Size:  int64(len(f.content)),
+			CRC32: sum,
+			Data: func(w io.Writer) error {
+				_, err := w.Write([]byte(f.content))
+
+				return err
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, nil)
+
+	return rw.Body.Bytes()
+}
+
+// archiveFile writes archive to a temporary file.
+func archiveFile(t *testing.T, archive []byte) string {
+	t.Helper()
+
+	fn := filepath.Join(t.TempDir(), "archive.zip")
+	if err := os.WriteFile(fn, archive, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return fn
+}
+
+// serveZip starts HTTP server with archive.
+func serveZip(t *testing.T, archive []byte) string {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		_, _ = rw.Write(archive)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv.URL + "/archive.zip"
+}
+
+func TestExtract(t *testing.T) {
+	url := serveZip(t, testZip(t,
+		testFile{name: "docs/a.txt", content: "a"},
+		testFile{name: "docs/b.tmp", content: "b"},
+		testFile{name: "readme.txt", content: "readme"},
+	))
+
+	out := t.TempDir()
+
+	if err := extract([]string{"-o", out, "-progress=false", "-include", "docs/*", "-exclude", "*.tmp", url}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := os.ReadFile(filepath.Join(out, "docs", "a.txt"))
+	if err != nil || string(c) != "a" {
+		t.Fatalf("unexpected contents %q, %v", c, err)
+	}
+
+	for _, name := range []string{"docs/b.tmp", "readme.txt"} {
+		if _, err := os.Stat(filepath.Join(out, filepath.FromSlash(name))); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("%s is not expected: %v", name, err)
+		}
+	}
+
+	// Existing file fails extraction by default.
+	if err := extract([]string{"-o", out, "-progress=false", url}); err == nil {
+		t.Fatal("error expected")
+	}
+
+	if err := extract([]string{"-o", out, "-progress=false", "-overwrite", "skip", url}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtract_checksum(t *testing.T) {
+	fn := archiveFile(t, testZip(t,
+		testFile{name: "a.txt", content: "hello", corrupt: true},
+		testFile{name: "b.txt", content: "world"},
+	))
+	out := t.TempDir()
+
+	err := extract([]string{"-o", out, "-progress=false", fn})
+
+	var ee exitError
+	if !errors.As(err, &ee) || ee.code != exitCodeChecksum {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Entries that follow corrupted one are extracted.
+	if c, err := os.ReadFile(filepath.Join(out, "b.txt")); err != nil || string(c) != "world" {
+		t.Fatalf("unexpected contents %q, %v", c, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(out, "a.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("corrupted file is not expected: %v", err)
+	}
+}
+
+func TestExtract_flags(t *testing.T) {
+	var g globs
+
+	if err := g.Set("[invalid"); err == nil {
+		t.Fatal("error expected for invalid pattern")
+	}
+
+	if err := g.Set("docs/*"); err != nil || g.String() != "docs/*" {
+		t.Fatalf("unexpected globs: %v, %v", g, err)
+	}
+
+	for _, args := range [][]string{
+		{"-overwrite", "never", "archive.zip"},
+		{"-progress=false"},
+		{"-progress=false", "a.zip", "b.zip"},
+		{"-progress=false", filepath.Join(t.TempDir(), "missing.zip")},
+	} {
+		if err := extract(args); err == nil {
+			t.Fatalf("error expected for %v", args)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vearutop/httpzip"
+)
+
+type entryInfo struct {
+	Offset           int64     `json:"offset"`
+	Name             string    `json:"name"`
+	Method           uint16    `json:"method"`
+	MethodName       string    `json:"methodName"`
+	Flags            uint16    `json:"flags"`
+	CompressedSize   uint64    `json:"compressedSize"`
+	UncompressedSize uint64    `json:"uncompressedSize"`
+	CRC32            uint32    `json:"crc32"`
+	Modified         time.Time `json:"modified"`
+	ModifiedSource   string    `json:"modifiedSource"`
+	DataDescriptor   bool      `json:"dataDescriptor"`
+	Zip64            bool      `json:"zip64"`
+	Verified         *bool     `json:"verified,omitempty"`
+	VerifyError      string    `json:"verifyError,omitempty"`
+	ReadSize         *uint64   `json:"readSize,omitempty"`
+}
+
+type inspectSummary struct {
+	Entries     int      `json:"entries"`
+	Failed      int      `json:"failed,omitempty"`
+	Error       string   `json:"error,omitempty"`
+	ErrorOffset *int64   `json:"errorOffset,omitempty"`
+	Mismatches  []string `json:"mismatches,omitempty"`
+}
+
+func inspect(args []string) error {
+	fl := flag.NewFlagSet("inspect", flag.ExitOnError)
+	fl.Usage = func() {
+		fmt.Fprintln(fl.Output(), "Usage: httpzip inspect [flags] <url|file|->")
+		fmt.Fprintln(fl.Output(), "Lists entries of ZIP stream without extracting, use - to read from STDIN.")
+		fl.PrintDefaults()
+	}
+
+	verify := fl.Bool("verify", false, "decompress entries to check CRC32 and sizes")
+	asJSON := fl.Bool("json", false, "print JSON lines instead of a table")
+	password := fl.String("password", "", "password for encrypted entries")
+	directory := fl.Bool("directory", false, "read central directory and check it against local entries")
+	strict := fl.Bool("strict", false, "fail on entries without CRC32 or with unverifiable checksum, implies -verify")
+
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+
+	if fl.NArg() != 1 {
+		fl.Usage()
+
+		return errors.New("exactly one source expected")
+	}
+
+	src, _, err := openSource(fl.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer src.Close() //nolint:errcheck
+
+	var (
+		sum inspectSummary
+		zr  = httpzip.NewStreamReader(src)
+	)
+
+	zr.Password = passwordFunc(*password)
+	zr.ReadCentralDirectory = *directory
+	zr.StrictChecksum = *strict
+
+	if *strict {
+		*verify = true
+	}
+
+	out := newInspectOutput(*asJSON, *verify)
+
+	for {
+		e, err := zr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var ve *httpzip.ValidationError
+		if errors.As(err, &ve) {
+			for _, m := range ve.Mismatches {
+				sum.Mismatches = append(sum.Mismatches, m.String())
+			}
+
+			break
+		}
+
+		if err != nil {
+			// Format errors point to the start of broken record.
+			offset := zr.Offset()
+
+			var fe *httpzip.FormatError
+			if errors.As(err, &fe) {
+				offset = fe.Offset
+			}
+
+			sum.Error = err.Error()
+			sum.ErrorOffset = &offset
+
+			break
+		}
+
+		if !*verify || e.IsDir() {
+			sum.Entries++
+
+			out.entry(newEntryInfo(e))
+
+			continue
+		}
+
+		// Entry info is collected after verification to have values from data descriptor.
+		n, err := verifyEntry(e)
+		ok := err == nil
+		info := newEntryInfo(e)
+		info.Verified = &ok
+		info.ReadSize = &n
+
+		if err != nil {
+			info.VerifyError = err.Error()
+			sum.Failed++
+		}
+
+		sum.Entries++
+
+		out.entry(info)
+	}
+
+	out.summary(sum)
+
+	if sum.Error != "" {
+		return fmt.Errorf("parsing failed at byte offset %d: %s", *sum.ErrorOffset, sum.Error)
+	}
+
+	if sum.Failed > 0 {
+		return fmt.Errorf("%d entries failed verification", sum.Failed)
+	}
+
+	if len(sum.Mismatches) > 0 {
+		return fmt.Errorf("central directory does not match local entries in %d fields", len(sum.Mismatches))
+	}
+
+	return nil
+}
+
+func newEntryInfo(e *httpzip.Entry) entryInfo {
+	return entryInfo{
+		Offset:           e.HeaderOffset(),
+		Name:             e.Name,
+		Method:           e.Method,
+		MethodName:       methodName(e.Method),
+		Flags:            e.Flags,
+		CompressedSize:   e.CompressedSize64,
+		UncompressedSize: e.UncompressedSize64,
+		CRC32:            e.CRC32,
+		Modified:         e.Modified,
+		ModifiedSource:   string(e.ModifiedSource),
+		DataDescriptor:   e.HasDataDescriptor(),
+		Zip64:            e.IsZip64(),
+	}
+}
+
+func verifyEntry(e *httpzip.Entry) (uint64, error) {
+	rc, err := e.Open()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(io.Discard, rc)
+	if err != nil {
+		return uint64(n), err
+	}
+
+	return uint64(n), rc.Close()
+}
+
+func methodName(method uint16) string {
+	switch method {
+	case zip.Store:
+		return "store"
+	case zip.Deflate:
+		return "deflate"
+	case httpzip.Deflate64:
+		return "deflate64"
+	case httpzip.BZIP2:
+		return "bzip2"
+	case httpzip.LZMA:
+		return "lzma"
+	case httpzip.Zstd:
+		return "zstd"
+	case httpzip.XZ:
+		return "xz"
+	case 99:
+		return "aes"
+	default:
+		return fmt.Sprintf("method-%d", method)
+	}
+}
+
+type inspectOutput struct {
+	json   *json.Encoder
+	table  *tabwriter.Writer
+	verify bool
+}
+
+func newInspectOutput(asJSON, verify bool) *inspectOutput {
+	o := &inspectOutput{verify: verify}
+
+	if asJSON {
+		o.json = json.NewEncoder(os.Stdout)
+
+		return o
+	}
+
+	o.table = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprint(o.table, "OFFSET\tMETHOD\tFLAGS\tCOMPRESSED\tSIZE\tCRC32\tMODIFIED\tSOURCE\tDD\tZIP64\t")
+
+	if verify {
+		fmt.Fprint(o.table, "VERIFY\t")
+	}
+
+	fmt.Fprintln(o.table, "NAME")
+
+	return o
+}
+
+func (o *inspectOutput) entry(info entryInfo) {
+	if o.json != nil {
+		_ = o.json.Encode(info)
+
+		return
+	}
+
+	fmt.Fprintf(o.table, "%d\t%s\t%#04x\t%d\t%d\t%08x\t%s\t%s\t%s\t%s\t",
+		info.Offset, info.MethodName, info.Flags, info.CompressedSize, info.UncompressedSize, info.CRC32,
+		info.Modified.Format(time.RFC3339), info.ModifiedSource, yesNo(info.DataDescriptor), yesNo(info.Zip64))
+
+	if o.verify {
+		switch {
+		case info.Verified == nil:
+			fmt.Fprint(o.table, "-\t")
+		case *info.Verified:
+			fmt.Fprint(o.table, "ok\t")
+		default:
+			fmt.Fprintf(o.table, "FAIL: %s\t", info.VerifyError)
+		}
+	}
+
+	fmt.Fprintln(o.table, info.Name)
+}
+
+func (o *inspectOutput) summary(sum inspectSummary) {
+	if o.json != nil {
+		_ = o.json.Encode(sum)
+
+		return
+	}
+
+	_ = o.table.Flush()
+
+	fmt.Printf("\n%d entries", sum.Entries)
+
+	if o.verify {
+		fmt.Printf(", %d failed verification", sum.Failed)
+	}
+
+	fmt.Println()
+
+	for _, m := range sum.Mismatches {
+		fmt.Println("mismatch:", m)
+	}
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+
+	return "no"
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureStdout returns output of fn to STDOUT.
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+
+	f, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = f
+
+	err = fn()
+
+	os.Stdout = stdout
+
+	if cerr := f.Close(); cerr != nil {
+		t.Fatal(cerr)
+	}
+
+	out, rerr := os.ReadFile(f.Name())
+	if rerr != nil {
+		t.Fatal(rerr)
+	}
+
+	return string(out), err
+}
+
+func TestInspect(t *testing.T) {
+	url := serveZip(t, testZip(t,
+		testFile{name: "a.txt", content: "hello"},
+		testFile{name: "b.txt", content: "world", corrupt: true},
+	))
+
+	out, err := captureStdout(t, func() error {
+		return inspect([]string{"-json", "-verify", url})
+	})
+	if err == nil || !strings.Contains(err.Error(), "1 entries failed verification") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected output: %s", out)
+	}
+
+	for i, name := range []string{"a.txt", "b.txt"} {
+		var info entryInfo
+		if err := json.Unmarshal([]byte(lines[i]), &info); err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Name != name || info.Verified == nil || *info.Verified != (name == "a.txt") {
+			t.Fatalf("unexpected entry: %s", lines[i])
+		}
+	}
+
+	var sum inspectSummary
+	if err := json.Unmarshal([]byte(lines[2]), &sum); err != nil {
+		t.Fatal(err)
+	}
+
+	if sum.Entries != 2 || sum.Failed != 1 {
+		t.Fatalf("unexpected summary: %s", lines[2])
+	}
+
+	out, err = captureStdout(t, func() error {
+		return inspect([]string{"-directory", url})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out, "a.txt") || !strings.Contains(out, "2 entries") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+}
+
+func TestInspect_flags(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"a.zip", "b.zip"},
+		{filepath.Join(t.TempDir(), "missing.zip")},
+	} {
+		if _, err := captureStdout(t, func() error { return inspect(args) }); err == nil {
+			t.Fatalf("error expected for %v", args)
+		}
+	}
+}
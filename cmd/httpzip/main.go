@@ -0,0 +1,68 @@
+// Package main provides httpzip command line tool.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: httpzip <command> [flags] [args]
+
+Commands:
+  serve    serve directories and manifests as ZIP downloads
+  extract  extract ZIP stream from URL, file or STDIN
+  inspect  list and verify entries of ZIP stream
+
+Run "httpzip <command> -h" for command flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+
+	switch os.Args[1] {
+	case "serve":
+		err = serve(os.Args[2:])
+	case "extract":
+		err = extract(os.Args[2:])
+	case "inspect":
+		err = inspect(os.Args[2:])
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "httpzip:", err)
+
+		var ee exitError
+		if errors.As(err, &ee) {
+			os.Exit(ee.code)
+		}
+
+		os.Exit(1)
+	}
+}
+
+// exitError overrides default exit code of a failed command.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e exitError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// TestMain_exitCode runs command in a subprocess to check its exit code.
+func TestMain_exitCode(t *testing.T) {
+	if args := os.Getenv("HTTPZIP_TEST_ARGS"); args != "" {
+		if err := json.Unmarshal([]byte(args), &os.Args); err != nil {
+			t.Fatal(err)
+		}
+
+		main()
+
+		return
+	}
+
+	valid := archiveFile(t, testZip(t, testFile{name: "a.txt", content: "hello"}))
+	corrupt := archiveFile(t, testZip(t, testFile{name: "a.txt", content: "hello", corrupt: true}))
+
+	for _, tc := range []struct {
+		name string
+		args []string
+		code int
+	}{
+		{name: "command", args: []string{"unknown"}, code: 2},
+		{name: "serve flags", args: []string{"serve", "-unknown"}, code: 2},
+		{name: "serve sources", args: []string{"serve"}, code: 1},
+		{name: "extracted", args: []string{"extract", "-progress=false", "-o", t.TempDir(), valid}},
+		{name: "checksum", args: []string{"extract", "-progress=false", "-o", t.TempDir(), corrupt}, code: exitCodeChecksum},
+		{name: "extract flags", args: []string{"extract", "-unknown"}, code: 2},
+		{name: "inspected", args: []string{"inspect", "-verify", valid}},
+		{name: "verification", args: []string{"inspect", "-verify", corrupt}, code: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			args, err := json.Marshal(append([]string{"httpzip"}, tc.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := exec.Command(os.Args[0], "-test.run=^TestMain_exitCode$") //nolint:gosec // Test binary is run again.
+			cmd.Env = append(os.Environ(), "HTTPZIP_TEST_ARGS="+string(args))
+
+			err = cmd.Run()
+
+			code := 0
+
+			var ee *exec.ExitError
+			if errors.As(err, &ee) {
+				code = ee.ExitCode()
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if code != tc.code {
+				t.Fatalf("unexpected exit code: %d", code)
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vearutop/httpzip"
+)
+
+// manifest lists files to be served in a single archive.
+type manifest struct {
+	Files []struct {
+		Path   string `json:"path"`   // Path in archive.
+		Source string `json:"source"` // Local file, relative to manifest location.
+	} `json:"files"`
+}
+
+type archiveSource struct {
+	name     string
+	path     string
+	manifest bool
+}
+
+func serve(args []string) error {
+	fl := flag.NewFlagSet("serve", flag.ExitOnError)
+	fl.Usage = func() {
+		fmt.Fprintln(fl.Output(), "Usage: httpzip serve [flags] [name=]<dir|manifest.json>...")
+		fmt.Fprintln(fl.Output(), "Each directory or JSON manifest is served as <prefix><name>.zip.")
+		fl.PrintDefaults()
+	}
+
+	listen := fl.String("listen", "localhost:8080", "listen address")
+	prefix := fl.String("prefix", "/", "URL path prefix")
+	streamable := fl.Bool("streamable", false, "use inlined file headers to allow streaming decoding")
+	ignoreCRC32 := fl.Bool("ignore-crc32", false, "do not precompute CRC32 for streamable archives")
+	accessLog := fl.Bool("access-log", false, "log served requests")
+
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+
+	if fl.NArg() == 0 {
+		fl.Usage()
+
+		return errors.New("no directories or manifests to serve")
+	}
+
+	p := "/" + strings.Trim(*prefix, "/") + "/"
+	if p == "//" {
+		p = "/"
+	}
+
+	sources := make(map[string]archiveSource, fl.NArg())
+
+	for _, arg := range fl.Args() {
+		src, err := newArchiveSource(arg)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := sources[src.name]; ok {
+			return fmt.Errorf("duplicate archive name %q", src.name)
+		}
+
+		sources[src.name] = src
+
+		log.Printf("serving %s as %s%s.zip", src.path, p, src.name)
+	}
+
+	var h http.Handler = archiveServer{
+		prefix:      p,
+		sources:     sources,
+		streamable:  *streamable,
+		ignoreCRC32: *ignoreCRC32,
+	}
+
+	if *accessLog {
+		h = logRequests(h)
+	}
+
+	log.Printf("listening on %s", *listen)
+
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return srv.ListenAndServe()
+}
+
+func newArchiveSource(arg string) (archiveSource, error) {
+	src := archiveSource{path: arg}
+
+	if name, p, found := strings.Cut(arg, "="); found {
+		src.name = name
+		src.path = p
+	}
+
+	fi, err := os.Stat(src.path)
+	if err != nil {
+		return src, err
+	}
+
+	src.manifest = !fi.IsDir()
+
+	if src.name == "" {
+		src.name = filepath.Base(filepath.Clean(src.path))
+
+		if src.manifest {
+			src.name = strings.TrimSuffix(src.name, filepath.Ext(src.name))
+		}
+	}
+
+	return src, nil
+}
+
+type archiveServer struct {
+	prefix      string
+	sources     map[string]archiveSource
+	streamable  bool
+	ignoreCRC32 bool
+}
+
+func (s archiveServer) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	if r.URL.Path == s.prefix {
+		s.index(rw)
+
+		return
+	}
+
+	name, found := strings.CutPrefix(r.URL.Path, s.prefix)
+	if !found || !strings.HasSuffix(name, ".zip") {
+		http.NotFound(rw, r)
+
+		return
+	}
+
+	src, found := s.sources[strings.TrimSuffix(name, ".zip")]
+	if !found {
+		http.NotFound(rw, r)
+
+		return
+	}
+
+	// Handler is built for every request to reflect current state of files.
+	h := httpzip.NewHandler(src.name)
+	h.Streamable = s.streamable
+	h.IgnoreCRC32 = s.ignoreCRC32
+	h.OnError = func(err error) {
+		log.Printf("serve %s: %s", r.URL.Path, err)
+	}
+
+	var files []httpzip.FileSource
+
+	var err error
+
+	if src.manifest {
+		files, err = manifestFiles(src.path)
+	} else {
+		files, err = dirFiles(src.path)
+	}
+
+	if err != nil {
+		h.OnError(err)
+		http.Error(rw, "failed to list files", http.StatusInternalServerError)
+
+		return
+	}
+
+	for _, f := range files {
+		if err := h.AddFile(f); err != nil {
+			h.OnError(err)
+			http.Error(rw, "failed to add file", http.StatusInternalServerError)
+
+			return
+		}
+	}
+
+	h.ServeHTTP(rw, r)
+}
+
+func (s archiveServer) index(rw http.ResponseWriter) {
+	names := make([]string, 0, len(s.sources))
+	for name := range s.sources {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	for _, name := range names {
+		fmt.Fprintf(rw, "%s%s.zip\n", s.prefix, name)
+	}
+}
+
+func dirFiles(dir string) ([]httpzip.FileSource, error) {
+	var files []httpzip.FileSource
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		f, err := localFile(filepath.ToSlash(rel), p)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, f)
+
+		return nil
+	})
+
+	return files, err
+}
+
+func manifestFiles(fn string) ([]httpzip.FileSource, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("decode manifest %s: %w", fn, err)
+	}
+
+	files := make([]httpzip.FileSource, 0, len(m.Files))
+	base := filepath.Dir(fn)
+
+	for _, mf := range m.Files {
+		src := mf.Source
+		if !filepath.IsAbs(src) {
+			src = filepath.Join(base, src)
+		}
+
+		p := mf.Path
+		if p == "" {
+			p = filepath.Base(src)
+		}
+
+		f, err := localFile(path.Clean(p), src)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+func localFile(name, fn string) (httpzip.FileSource, error) {
+	fi, err := os.Stat(fn)
+	if err != nil {
+		return httpzip.FileSource{}, err
+	}
+
+	if !fi.Mode().IsRegular() {
+		return httpzip.FileSource{}, fmt.Errorf("%s is not a regular file", fn)
+	}
+
+	size := fi.Size()
+
+	return httpzip.FileSource{
+		Path:     name,
+		Modified: fi.ModTime(),
+		Size:     size,
+		Data: func(w io.Writer) error {
+			f, err := os.Open(fn) //nolint:gosec // File name comes from operator configuration.
+			if err != nil {
+				return err
+			}
+			defer f.Close() //nolint:errcheck
+
+			// Exactly Size bytes are copied to keep Content-Length valid.
+			_, err = io.CopyN(w, f, size)
+
+			return err
+		},
+	}, nil
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	n, err := r.ResponseWriter.Write(p)
+	r.written += int64(n)
+
+	return n, err
+}
+
+func logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: rw}
+
+		h.ServeHTTP(rec, r)
+
+		log.Printf("%s %s %s %d %d %s", r.RemoteAddr, r.Method, r.URL.RequestURI(), rec.status, rec.written, time.Since(start).Round(time.Millisecond))
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestArchiveServer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "docs")
+
+	for name, content := range map[string]string{"a.txt": "a", "sub/b.txt": "b"} {
+		fn := filepath.Join(dir, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(fn), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(fn, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifestFile := filepath.Join(t.TempDir(), "bundle.json")
+	if err := os.WriteFile(manifestFile, []byte(`{"files": [{"path": "docs/readme.txt", "source": "`+
+		filepath.ToSlash(filepath.Join(dir, "a.txt"))+`"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	sources := map[string]archiveSource{}
+
+	for _, arg := range []string{dir, "manual=" + dir, manifestFile} {
+		src, err := newArchiveSource(arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sources[src.name] = src
+	}
+
+	for _, streamable := range []bool{false, true} {
+		srv := httptest.NewServer(logRequests(archiveServer{prefix: "/files/", sources: sources, streamable: streamable}))
+
+		get := func(p string) (*http.Response, []byte) {
+			resp, err := http.Get(srv.URL + p) //nolint:noctx // Test request.
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close() //nolint:errcheck
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return resp, body
+		}
+
+		_, index := get("/files/")
+		if string(index) != "/files/bundle.zip\n/files/docs.zip\n/files/manual.zip\n" {
+			t.Fatalf("unexpected index: %s", index)
+		}
+
+		for p, expected := range map[string]map[string]string{
+			"/files/docs.zip":   {"a.txt": "a", "sub/b.txt": "b"},
+			"/files/bundle.zip": {"docs/readme.txt": "a"},
+		} {
+			resp, body := get(p)
+
+			if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Length") != strconv.Itoa(len(body)) {
+				t.Fatalf("unexpected response: %d %v", resp.StatusCode, resp.Header)
+			}
+
+			zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(zr.File) != len(expected) {
+				t.Fatalf("unexpected entries: %d", len(zr.File))
+			}
+
+			for _, f := range zr.File {
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				c, err := io.ReadAll(rc)
+				if err != nil || string(c) != expected[f.Name] {
+					t.Fatalf("unexpected contents of %s: %q, %v", f.Name, c, err)
+				}
+			}
+		}
+
+		if resp, _ := get("/files/missing.zip"); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("unexpected status: %d", resp.StatusCode)
+		}
+
+		resp, err := http.Post(srv.URL+"/files/docs.zip", "text/plain", nil) //nolint:noctx // Test request.
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Fatalf("unexpected status: %d", resp.StatusCode)
+		}
+
+		srv.Close()
+	}
+}
+
+func TestServe_flags(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, args := range [][]string{
+		{},
+		{filepath.Join(dir, "missing")},
+		{"a=" + dir, "a=" + dir},
+		{"-listen", "localhost:-1", dir},
+	} {
+		if err := serve(args); err == nil {
+			t.Fatalf("error expected for %v", args)
+		}
+	}
+}
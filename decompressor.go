@@ -0,0 +1,67 @@
+package httpzip
+
+import (
+	"archive/zip"
+	"compress/bzip2"
+	"compress/flate"
+	"io"
+	"sync"
+)
+
+// Compression methods that are not defined in archive/zip.
+// Only BZIP2 is supported by default, others need RegisterDecompressor.
+const (
+	Deflate64 uint16 = 9  // Enhanced Deflate.
+	BZIP2     uint16 = 12 // BZIP2, built in.
+	LZMA      uint16 = 14 // LZMA.
+	Zstd      uint16 = 93 // Zstandard.
+	XZ        uint16 = 95 // XZ.
+)
+
+var decompressors sync.Map // map[uint16]zip.Decompressor
+
+func init() {
+	decompressors.Store(zip.Store, zip.Decompressor(io.NopCloser))
+	decompressors.Store(zip.Deflate, zip.Decompressor(flate.NewReader))
+	decompressors.Store(BZIP2, zip.Decompressor(func(r io.Reader) io.ReadCloser {
+		return io.NopCloser(bzip2.NewReader(r))
+	}))
+}
+
+// RegisterDecompressor registers or overrides a custom decompressor for a specific method ID.
+// Registered decompressor is used by all instances of StreamReader.
+//
+// Entries with data descriptor and unknown compressed size can only be read with Deflate and Deflate64,
+// Deflate64 decompressor receives an io.ByteReader and must not read beyond the end of compressed data.
+func RegisterDecompressor(method uint16, dcomp zip.Decompressor) {
+	decompressors.Store(method, dcomp)
+}
+
+// RegisterDecompressor registers or overrides a custom decompressor for a specific method ID.
+// If a decompressor for a given method is not found, StreamReader will default to looking up
+// the decompressor at the package level.
+func (z *StreamReader) RegisterDecompressor(method uint16, dcomp zip.Decompressor) {
+	if z.decompressors == nil {
+		z.decompressors = make(map[uint16]zip.Decompressor)
+	}
+
+	z.decompressors[method] = dcomp
+}
+
+func (z *StreamReader) decompressor(method uint16) zip.Decompressor {
+	dcomp := z.decompressors[method]
+	if dcomp == nil {
+		dcomp = decompressor(method)
+	}
+
+	return dcomp
+}
+
+// decompressor returns package level decompressor.
+func decompressor(method uint16) zip.Decompressor {
+	if di, ok := decompressors.Load(method); ok {
+		return di.(zip.Decompressor) //nolint:errcheck // Map only contains decompressors.
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package httpzip_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+
+	"github.com/vearutop/httpzip"
+)
+
+// reverse is a toy compression method for tests.
+func reverse(r io.Reader) io.ReadCloser {
+	b, err := io.ReadAll(r)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+
+	if err != nil {
+		return io.NopCloser(io.MultiReader(bytes.NewReader(b), errReader{err: err}))
+	}
+
+	return io.NopCloser(bytes.NewReader(b))
+}
+
+type errReader struct {
+	err error
+}
+
+func (e errReader) Read([]byte) (int, error) {
+	return 0, e.err
+}
+
+func TestStreamReader_RegisterDecompressor(t *testing.T) {
+	c := []byte("hello world")
+	compressed, _ := io.ReadAll(reverse(bytes.NewReader(c)))
+
+	buf := bytes.NewBuffer(nil)
+	w := zip.NewWriter(buf)
+
+	f, err := w.CreateRaw(&zip.FileHeader{
+		Name:               "file.txt",
+		Method:             httpzip.Zstd,
+		CRC32:              crc32.ChecksumIEEE(c),
+		CompressedSize64:   uint64(len(compressed)),
+		UncompressedSize64: uint64(len(c)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Write(compressed); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sr := httpzip.NewStreamReader(bytes.NewReader(buf.Bytes()))
+
+	e, err := sr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.Open(); !errors.Is(err, zip.ErrAlgorithm) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sr = httpzip.NewStreamReader(bytes.NewReader(buf.Bytes()))
+	sr.RegisterDecompressor(httpzip.Zstd, reverse)
+
+	e, err = sr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := e.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(res, c) {
+		t.Fatalf("unexpected contents %q", string(res))
+	}
+
+	if _, err := sr.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestStreamReader_RegisterDecompressor_unknownSize(t *testing.T) {
+	c := []byte("hello world")
+	compressed, _ := io.ReadAll(reverse(bytes.NewReader(c)))
+
+	buf := bytes.NewBuffer(nil)
+	w := zip.NewWriter(buf)
+
+	// Sizes are written to data descriptor only.
+	f, err := w.CreateRaw(&zip.FileHeader{
+		Name:               "file.txt",
+		Method:             httpzip.Zstd,
+		Flags:              0x8,
+		CRC32:              crc32.ChecksumIEEE(c),
+		CompressedSize:     uint32(len(compressed)),
+		UncompressedSize:   uint32(len(c)),
+		CompressedSize64:   uint64(len(compressed)),
+		UncompressedSize64: uint64(len(c)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Write(compressed); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sr := httpzip.NewStreamReader(bytes.NewReader(buf.Bytes()))
+	sr.RegisterDecompressor(httpzip.Zstd, reverse)
+
+	e, err := sr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Decompressor may read beyond the end of data, so that the end of entry can not be found.
+	var me *httpzip.UnsupportedMethodError
+	if _, err := e.Open(); !errors.As(err, &me) || me.Method != httpzip.Zstd {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
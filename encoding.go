@@ -0,0 +1,115 @@
+package httpzip
+
+import (
+	"hash/crc32"
+	"unicode/utf8"
+)
+
+// Info-ZIP Unicode extra field IDs.
+const (
+	UnicodeCommentExtraID = 0x6375 // UTF-8 entry comment.
+	UnicodePathExtraID    = 0x7075 // UTF-8 entry name.
+)
+
+// flagUTF8 is a general purpose flag bit 11, name and comment are UTF-8.
+const flagUTF8 = 0x800
+
+// cp437 maps upper half of IBM PC code page 437 to Unicode.
+var cp437 = [128]rune{
+	'Ç', 'ü', 'é', 'â', 'ä', 'à', 'å', 'ç', 'ê', 'ë', 'è', 'ï', 'î', 'ì', 'Ä', 'Å',
+	'É', 'æ', 'Æ', 'ô', 'ö', 'ò', 'û', 'ù', 'ÿ', 'Ö', 'Ü', '¢', '£', '¥', '₧', 'ƒ',
+	'á', 'í', 'ó', 'ú', 'ñ', 'Ñ', 'ª', 'º', '¿', '⌐', '¬', '½', '¼', '¡', '«', '»',
+	'░', '▒', '▓', '│', '┤', '╡', '╢', '╖', '╕', '╣', '║', '╗', '╝', '╜', '╛', '┐',
+	'└', '┴', '┬', '├', '─', '┼', '╞', '╟', '╚', '╔', '╩', '╦', '╠', '═', '╬', '╧',
+	'╨', '╤', '╥', '╙', '╘', '╒', '╓', '╫', '╪', '┘', '┌', '█', '▄', '▌', '▐', '▀',
+	'α', 'ß', 'Γ', 'π', 'Σ', 'σ', 'µ', 'τ', 'Φ', 'Θ', 'Ω', 'δ', '∞', 'φ', 'ε', '∩',
+	'≡', '±', '≥', '≤', '⌠', '⌡', '÷', '≈', '°', '∙', '·', '√', 'ⁿ', '²', '■', ' ',
+}
+
+// DecodeCP437 converts IBM PC code page 437 text to UTF-8, it is the default encoding of ZIP names and comments.
+func DecodeCP437(b []byte) ([]byte, error) {
+	res := make([]byte, 0, len(b))
+
+	for _, c := range b {
+		if c < 0x80 {
+			res = append(res, c)
+
+			continue
+		}
+
+		res = utf8.AppendRune(res, cp437[c-0x80])
+	}
+
+	return res, nil
+}
+
+// decodeText returns UTF-8 value of entry name or comment.
+//
+// Text is used as is if it has UTF-8 flag, otherwise matching Info-ZIP Unicode extra field
+// is used, and then LegacyDecoder. Without LegacyDecoder text that is valid UTF-8 is kept,
+// because many tools do not set the flag, and other text is decoded as CP437.
+func (z *StreamReader) decodeText(raw []byte, flags uint16, extra []byte, unicodeID uint16) string {
+	if flags&flagUTF8 != 0 {
+		return string(raw)
+	}
+
+	if s, ok := unicodeExtra(extra, unicodeID, raw); ok {
+		return s
+	}
+
+	decode := z.LegacyDecoder
+
+	if decode == nil {
+		if utf8.Valid(raw) {
+			return string(raw)
+		}
+
+		decode = DecodeCP437
+	}
+
+	b, err := decode(raw)
+	if err != nil {
+		return string(raw)
+	}
+
+	return string(b)
+}
+
+// unicodeExtra returns UTF-8 text from Info-ZIP Unicode extra field if its CRC32 matches raw text.
+func unicodeExtra(extra []byte, id uint16, raw []byte) (string, bool) {
+	for b := readBuf(extra); len(b) >= 4; {
+		fieldID := b.uint16()
+		size := int(b.uint16())
+
+		if len(b) < size {
+			break
+		}
+
+		f := b.sub(size)
+
+		// Version 1, CRC32 of raw text, UTF-8 text.
+		if fieldID != id || len(f) < 5 || f.uint8() != 1 {
+			continue
+		}
+
+		// Stale field of a renamed entry is ignored.
+		if f.uint32() != crc32.ChecksumIEEE(raw) || !utf8.Valid(f) {
+			continue
+		}
+
+		return string(f), true
+	}
+
+	return "", false
+}
+
+// isASCII checks if string has only 7-bit characters.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
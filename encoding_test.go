@@ -0,0 +1,107 @@
+package httpzip_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"hash/crc32"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vearutop/httpzip"
+)
+
+func rawNameArchive(t *testing.T, name string, extra []byte) []byte {
+	t.Helper()
+
+	return zipArchive(t, zipEntry{name: name, extra: extra, raw: true})
+}
+
+func TestStreamReader_Next_legacyName(t *testing.T) {
+	raw := "caf\x82.txt" // "café.txt" in CP437.
+	unicodePath := func(crc uint32, name string) []byte {
+		return extraField(httpzip.UnicodePathExtraID, uint8(1), crc, []byte(name))
+	}
+
+	for _, tc := range []struct {
+		name     string
+		extra    []byte
+		decoder  func(b []byte) ([]byte, error)
+		expected string
+	}{
+		{name: "cp437", expected: "café.txt"},
+		{name: "unicode path", extra: unicodePath(crc32.ChecksumIEEE([]byte(raw)), "кафе.txt"), expected: "кафе.txt"},
+		{name: "stale unicode path", extra: unicodePath(1, "кафе.txt"), expected: "café.txt"},
+		{
+			name: "decoder",
+			decoder: func(b []byte) ([]byte, error) {
+				return bytes.ReplaceAll(b, []byte{0x82}, []byte("е")), nil
+			},
+			expected: "cafе.txt",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			archive := rawNameArchive(t, raw, tc.extra)
+
+			for _, directory := range []bool{false, true} {
+				sr := httpzip.NewStreamReader(bytes.NewReader(archive))
+				sr.LegacyDecoder = tc.decoder
+				sr.ReadCentralDirectory = directory
+
+				entries, err := readAll(sr)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if entries[0].Name != tc.expected || !entries[0].NonUTF8 {
+					t.Fatalf("unexpected name %q", entries[0].Name)
+				}
+			}
+		})
+	}
+
+	// Names that are valid UTF-8 are kept even without the flag.
+	entries, err := readAll(httpzip.NewStreamReader(bytes.NewReader(rawNameArchive(t, "café.txt", nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entries[0].Name != "café.txt" {
+		t.Fatalf("unexpected name %q", entries[0].Name)
+	}
+}
+
+func TestHandler_AddFile_utf8Flag(t *testing.T) {
+	for _, streamable := range []bool{false, true} {
+		h := httpzip.NewHandler("archive")
+		h.Streamable = streamable
+
+		for _, name := range []string{"plain.txt", "café.txt"} {
+			if err := h.AddFile(httpzip.FileSource{
+				Path: name,
+				Size: 2,
+				Data: func(w io.Writer) error {
+					_, err := w.Write([]byte("ok"))
+
+					return err
+				},
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, nil)
+
+		zr, err := zip.NewReader(bytes.NewReader(rw.Body.Bytes()), int64(rw.Body.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, f := range zr.File {
+			if utf8 := f.Flags&0x800 != 0; utf8 != (f.Name == "café.txt") {
+				t.Fatalf("streamable=%v: unexpected UTF-8 flag for %s", streamable, f.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,497 @@
+package httpzip
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // SHA1 is mandated by WinZip AES specification.
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// Decryption errors, both match ErrEncrypted.
+var (
+	ErrPasswordRequired = fmt.Errorf("%w: password required", ErrEncrypted)
+	ErrWrongPassword    = fmt.Errorf("%w: wrong password", ErrEncrypted)
+)
+
+// EncryptionMethod defines how archive entries are encrypted.
+type EncryptionMethod int
+
+// Encryption methods.
+const (
+	// AES256 is WinZip AE-2 encryption with 256-bit AES key, it is the default.
+	AES256 EncryptionMethod = iota
+
+	// ZipCrypto is traditional PKWARE encryption, it is weak and should only be used for compatibility with old tools.
+	ZipCrypto
+)
+
+// Encryption describes password protection of archive entries.
+type Encryption struct {
+	Password string
+	Method   EncryptionMethod
+}
+
+func (e *Encryption) method() EncryptionMethod {
+	if e == nil {
+		return -1
+	}
+
+	return e.Method
+}
+
+// overhead returns number of bytes added to entry data by encryption.
+func (e *Encryption) overhead() int64 {
+	switch e.method() {
+	case AES256:
+		return aesOverhead
+	case ZipCrypto:
+		return zipCryptoHeaderLen
+	default:
+		return 0
+	}
+}
+
+const (
+	methodWinZipAES = 99
+
+	aesVendorVersion = 2 // AE-2, CRC32 is not stored.
+	aesStrength256   = 3
+	aesKeyLen        = 32
+	aesSaltLen       = 16
+	aesVerifierLen   = 2
+	aesMACLen        = 10
+	aesOverhead      = aesSaltLen + aesVerifierLen + aesMACLen
+	aesIterations    = 1000
+
+	zipCryptoHeaderLen = 12
+)
+
+// aesExtra returns WinZip AES extra field for the actual compression method.
+func aesExtra(method uint16) []byte {
+	b := make([]byte, 11)
+	binary.LittleEndian.PutUint16(b[0:], AESExtraID)
+	binary.LittleEndian.PutUint16(b[2:], 7) // Data size.
+	binary.LittleEndian.PutUint16(b[4:], aesVendorVersion)
+	b[6], b[7] = 'A', 'E'
+	b[8] = aesStrength256
+	binary.LittleEndian.PutUint16(b[9:], method)
+
+	return b
+}
+
+// aesKeys derives encryption key, authentication key and password verifier.
+func aesKeys(password, salt []byte, keyLen int) (encKey, authKey, verifier []byte) {
+	dk := pbkdf2SHA1(password, salt, aesIterations, 2*keyLen+aesVerifierLen)
+
+	return dk[:keyLen], dk[keyLen : 2*keyLen], dk[2*keyLen:]
+}
+
+func pbkdf2SHA1(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha1.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:4])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = u[:0]
+			u = prf.Sum(u)
+
+			for x := range u {
+				t[x] ^= u[x]
+			}
+		}
+	}
+
+	return dk[:keyLen]
+}
+
+// winZipCTR is AES in counter mode with little-endian counter starting from 1, as used by WinZip.
+type winZipCTR struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	pos     int
+}
+
+func newWinZipCTR(key []byte) (*winZipCTR, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &winZipCTR{block: block, pos: aes.BlockSize}, nil
+}
+
+func (c *winZipCTR) XORKeyStream(dst, src []byte) {
+	for i, b := range src {
+		if c.pos == aes.BlockSize {
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+
+			c.block.Encrypt(c.stream[:], c.counter[:])
+			c.pos = 0
+		}
+
+		dst[i] = b ^ c.stream[c.pos]
+		c.pos++
+	}
+}
+
+// aesWriter encrypts entry contents with WinZip AES.
+type aesWriter struct {
+	w   io.Writer
+	ctr *winZipCTR
+	mac hash.Hash
+	buf []byte
+}
+
+func newAESWriter(w io.Writer, password string) (*aesWriter, error) {
+	salt := make([]byte, aesSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	encKey, authKey, verifier := aesKeys([]byte(password), salt, aesKeyLen)
+
+	ctr, err := newWinZipCTR(encKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(append(salt, verifier...)); err != nil {
+		return nil, err
+	}
+
+	return &aesWriter{
+		w:   w,
+		ctr: ctr,
+		mac: hmac.New(sha1.New, authKey),
+	}, nil
+}
+
+func (a *aesWriter) Write(p []byte) (int, error) {
+	if cap(a.buf) < len(p) {
+		a.buf = make([]byte, len(p))
+	}
+
+	buf := a.buf[:len(p)]
+	a.ctr.XORKeyStream(buf, p)
+	a.mac.Write(buf)
+
+	return a.w.Write(buf)
+}
+
+// Close writes authentication code.
+func (a *aesWriter) Close() error {
+	_, err := a.w.Write(a.mac.Sum(nil)[:aesMACLen])
+
+	return err
+}
+
+// zipCryptoKeys is a state of traditional PKWARE encryption.
+type zipCryptoKeys [3]uint32
+
+func newZipCryptoKeys(password []byte) *zipCryptoKeys {
+	k := &zipCryptoKeys{0x12345678, 0x23456789, 0x34567890}
+
+	for _, b := range password {
+		k.update(b)
+	}
+
+	return k
+}
+
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ (crc >> 8)
+}
+
+func (k *zipCryptoKeys) update(b byte) {
+	k[0] = crc32Update(k[0], b)
+	k[1] += k[0] & 0xff
+	k[1] = k[1]*134775813 + 1
+	k[2] = crc32Update(k[2], byte(k[1]>>24))
+}
+
+func (k *zipCryptoKeys) streamByte() byte {
+	t := k[2] | 2
+
+	return byte((t * (t ^ 1)) >> 8)
+}
+
+func (k *zipCryptoKeys) encrypt(dst, src []byte) {
+	for i, b := range src {
+		dst[i] = b ^ k.streamByte()
+		k.update(b)
+	}
+}
+
+func (k *zipCryptoKeys) decrypt(dst, src []byte) {
+	for i, c := range src {
+		b := c ^ k.streamByte()
+		k.update(b)
+		dst[i] = b
+	}
+}
+
+// zipCryptoWriter encrypts entry contents with traditional PKWARE encryption.
+type zipCryptoWriter struct {
+	w    io.Writer
+	keys *zipCryptoKeys
+	buf  []byte
+}
+
+// newZipCryptoWriter writes encryption header, check byte is used by readers to verify password.
+func newZipCryptoWriter(w io.Writer, password string, check byte) (*zipCryptoWriter, error) {
+	header := make([]byte, zipCryptoHeaderLen)
+	if _, err := rand.Read(header[:zipCryptoHeaderLen-1]); err != nil {
+		return nil, err
+	}
+
+	header[zipCryptoHeaderLen-1] = check
+
+	z := &zipCryptoWriter{
+		w:    w,
+		keys: newZipCryptoKeys([]byte(password)),
+	}
+
+	if _, err := z.Write(header); err != nil {
+		return nil, err
+	}
+
+	return z, nil
+}
+
+func (z *zipCryptoWriter) Write(p []byte) (int, error) {
+	if cap(z.buf) < len(p) {
+		z.buf = make([]byte, len(p))
+	}
+
+	buf := z.buf[:len(p)]
+	z.keys.encrypt(buf, p)
+
+	return z.w.Write(buf)
+}
+
+// aesInfo is a parsed WinZip AES extra field.
+type aesInfo struct {
+	version  uint16
+	strength uint8
+	method   uint16 // Actual compression method.
+}
+
+// decrypt returns reader of decrypted entry data and actual compression method.
+func (e *Entry) decrypt(r io.Reader) (io.Reader, uint16, error) {
+	if e.Flags&0x40 != 0 {
+		return nil, 0, fmt.Errorf("%s: %w: strong encryption is not supported", e.Name, ErrEncrypted)
+	}
+
+	if e.z == nil || e.z.Password == nil {
+		return nil, 0, fmt.Errorf("%s: %w", e.Name, ErrPasswordRequired)
+	}
+
+	password, err := e.z.Password(e)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if e.Method != methodWinZipAES {
+		// Check byte is derived from modification time if CRC32 is not known before entry data.
+		check := byte(e.CRC32 >> 24)
+		if e.hasDataDescriptor() {
+			check = byte(e.ModifiedTime >> 8)
+		}
+
+		zr, err := newZipCryptoReader(r, password, check)
+		if err != nil {
+			return nil, 0, e.decryptionError(err)
+		}
+
+		return zr, e.Method, nil
+	}
+
+	if e.aes == nil {
+		return nil, 0, e.extraError(AESExtraID)
+	}
+
+	if e.unknownSize {
+		return nil, 0, fmt.Errorf("%s: %w: AES encrypted entry of unknown size is not supported", e.Name, ErrEncrypted)
+	}
+
+	ar, err := newAESReader(r, e.CompressedSize64, e.aes.strength, password)
+	if err != nil {
+		return nil, 0, e.decryptionError(err)
+	}
+
+	ar.entry = e.Name
+	ar.trailer = e.dataOffset + int64(e.CompressedSize64) - aesMACLen
+
+	return ar, e.aes.method, nil
+}
+
+// decryptionError adds entry name and offset to errors of encryption header.
+func (e *Entry) decryptionError(err error) error {
+	var fe *FormatError
+	if errors.As(err, &fe) {
+		fe.Offset = e.dataOffset
+		fe.Entry = e.Name
+
+		return fe
+	}
+
+	if errors.Is(err, ErrEncrypted) {
+		return fmt.Errorf("%s: %w", e.Name, err)
+	}
+
+	return readError(e.dataOffset, e.Name, RecordEncryptionHeader, err)
+}
+
+// encryptionOverhead returns number of bytes added to entry data by encryption.
+func (e *Entry) encryptionOverhead() int64 {
+	switch {
+	case e.Flags&1 == 0:
+		return 0
+	case e.Method == methodWinZipAES:
+		return aesOverhead
+	default:
+		return zipCryptoHeaderLen
+	}
+}
+
+// aesReader decrypts WinZip AES entry data and verifies authentication code.
+type aesReader struct {
+	src  io.Reader
+	data io.Reader
+	ctr  *winZipCTR
+	mac  hash.Hash
+	err  error
+
+	entry   string
+	trailer int64 // Stream offset of authentication code.
+}
+
+func newAESReader(r io.Reader, size uint64, strength uint8, password string) (*aesReader, error) {
+	if strength < 1 || strength > 3 {
+		return nil, &FormatError{Record: RecordEncryptionHeader, Err: fmt.Errorf("invalid AES strength %d", strength)}
+	}
+
+	keyLen := 8 + 8*int(strength) // 16, 24 or 32 bytes.
+	saltLen := keyLen / 2
+
+	if size < uint64(saltLen+aesVerifierLen+aesMACLen) {
+		return nil, &FormatError{Record: RecordEncryptionHeader, Err: fmt.Errorf("%d bytes is too short for AES", size)}
+	}
+
+	buf := make([]byte, saltLen+aesVerifierLen)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	encKey, authKey, verifier := aesKeys([]byte(password), buf[:saltLen], keyLen)
+	if !hmac.Equal(verifier, buf[saltLen:]) {
+		return nil, ErrWrongPassword
+	}
+
+	ctr, err := newWinZipCTR(encKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &aesReader{
+		src:  r,
+		data: io.LimitReader(r, int64(size)-int64(len(buf)+aesMACLen)),
+		ctr:  ctr,
+		mac:  hmac.New(sha1.New, authKey),
+	}, nil
+}
+
+func (a *aesReader) Read(p []byte) (int, error) {
+	if a.err != nil {
+		return 0, a.err
+	}
+
+	n, err := a.data.Read(p)
+	a.mac.Write(p[:n])
+	a.ctr.XORKeyStream(p[:n], p[:n])
+
+	if err == io.EOF {
+		code := make([]byte, aesMACLen)
+		if _, err1 := io.ReadFull(a.src, code); err1 != nil {
+			err = readError(a.trailer, a.entry, RecordEncryptionTrailer, err1)
+		} else if actual := a.mac.Sum(nil)[:aesMACLen]; !hmac.Equal(code, actual) {
+			err = &ChecksumError{
+				Entry:    a.entry,
+				Expected: binary.BigEndian.Uint32(code),
+				Actual:   binary.BigEndian.Uint32(actual),
+			}
+		}
+	}
+
+	a.err = err
+
+	return n, err
+}
+
+// zipCryptoReader decrypts entry data with traditional PKWARE encryption.
+type zipCryptoReader struct {
+	r    io.Reader
+	keys *zipCryptoKeys
+}
+
+func newZipCryptoReader(r io.Reader, password string, check byte) (*zipCryptoReader, error) {
+	keys := newZipCryptoKeys([]byte(password))
+
+	header := make([]byte, zipCryptoHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	keys.decrypt(header, header)
+
+	if header[zipCryptoHeaderLen-1] != check {
+		return nil, ErrWrongPassword
+	}
+
+	return &zipCryptoReader{r: r, keys: keys}, nil
+}
+
+func (z *zipCryptoReader) Read(p []byte) (int, error) {
+	n, err := z.r.Read(p)
+	z.keys.decrypt(p[:n], p[:n])
+
+	return n, err
+}
+
+// ReadByte allows decompressor to stop exactly at the end of data of unknown size.
+func (z *zipCryptoReader) ReadByte() (byte, error) {
+	var b [1]byte
+
+	_, err := io.ReadFull(z, b[:])
+
+	return b[0], err
+}
@@ -0,0 +1,233 @@
+package httpzip_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/vearutop/httpzip"
+)
+
+func TestHandler_Encryption(t *testing.T) {
+	for _, streamable := range []bool{false, true} {
+		for _, method := range []httpzip.EncryptionMethod{httpzip.AES256, httpzip.ZipCrypto} {
+			t.Run(fmt.Sprintf("streamable=%v,method=%d", streamable, method), func(t *testing.T) {
+				rw := httptest.NewRecorder()
+
+				h := httpzip.NewHandler("archive")
+				h.Streamable = streamable
+				h.Encryption = &httpzip.Encryption{Password: "secret", Method: method}
+
+				for i := 0; i < 3; i++ {
+					c := fmt.Sprintf("hello world %d", i)
+					fs := httpzip.FileSource{
+						Path:     fmt.Sprintf("file_%d.txt", i),
+						Modified: time.Now(),
+						Size:     int64(len(c)),
+						Data: func(w io.Writer) error {
+							_, err := w.Write([]byte(c))
+
+							return err
+						},
+					}
+
+					if i == 2 {
+						fs.Encryption = &httpzip.Encryption{} // Plain entry.
+					}
+
+					if err := h.AddFile(fs); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				h.ServeHTTP(rw, nil)
+
+				if rw.Header().Get("Content-Length") != strconv.Itoa(rw.Body.Len()) {
+					t.Fatalf("unexpected Content-Length %s, %d bytes received", rw.Header().Get("Content-Length"), rw.Body.Len())
+				}
+
+				zr, err := zip.NewReader(bytes.NewReader(rw.Body.Bytes()), int64(rw.Body.Len()))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for i, f := range zr.File {
+					encrypted := f.Flags&1 != 0
+					if encrypted != (i != 2) {
+						t.Fatalf("unexpected encryption flag for %s", f.Name)
+					}
+
+					if encrypted && method == httpzip.AES256 && f.Method != 99 {
+						t.Fatalf("unexpected method %d for %s", f.Method, f.Name)
+					}
+
+					// Plain streamable entries keep header fields of unencrypted archives.
+					if !encrypted && streamable && (f.ReaderVersion != 0 || f.ModifiedDate != 0 || f.ModifiedTime != 0) {
+						t.Fatalf("unexpected header fields of %s: %+v", f.Name, f.FileHeader)
+					}
+				}
+
+				for _, password := range []string{"secret", "wrong"} {
+					sr := httpzip.NewStreamReader(bytes.NewReader(rw.Body.Bytes()))
+					sr.Password = func(_ *httpzip.Entry) (string, error) {
+						return password, nil
+					}
+
+					for i := 0; i < 3; i++ {
+						e, err := sr.Next()
+						if err != nil {
+							t.Fatal(err)
+						}
+
+						rc, err := e.Open()
+						if password == "wrong" && i != 2 {
+							// ZipCrypto check byte accepts wrong password with 1/256 chance, data fails CRC32 then.
+							if err == nil && method == httpzip.ZipCrypto {
+								_, err = io.ReadAll(rc)
+
+								var ce *httpzip.ChecksumError
+								if !errors.As(err, &ce) {
+									t.Fatalf("unexpected error: %v", err)
+								}
+
+								continue
+							}
+
+							if !errors.Is(err, httpzip.ErrWrongPassword) || !errors.Is(err, httpzip.ErrEncrypted) {
+								t.Fatalf("unexpected error: %v", err)
+							}
+
+							continue
+						}
+
+						if err != nil {
+							t.Fatal(err)
+						}
+
+						c, err := io.ReadAll(rc)
+						if err != nil {
+							t.Fatal(err)
+						}
+
+						if string(c) != fmt.Sprintf("hello world %d", i) {
+							t.Fatalf("unexpected contents %q", string(c))
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestStreamReader_StrictChecksum_encrypted(t *testing.T) {
+	rw := httptest.NewRecorder()
+
+	h := httpzip.NewHandler("archive")
+	h.Encryption = &httpzip.Encryption{Password: "secret"}
+
+	if err := h.AddFile(httpzip.FileSource{
+		Path: "a.txt",
+		Size: 5,
+		Data: func(w io.Writer) error {
+			_, err := w.Write([]byte("hello"))
+
+			return err
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	h.ServeHTTP(rw, nil)
+
+	sr := httpzip.NewStreamReader(bytes.NewReader(rw.Body.Bytes()))
+	sr.StrictChecksum = true
+
+	if _, err := readAll(sr); !errors.Is(err, httpzip.ErrUnverified) || !errors.Is(err, httpzip.ErrPasswordRequired) {
+		t.Fatalf("unverified error expected, got %v", err)
+	}
+
+	sr = httpzip.NewStreamReader(bytes.NewReader(rw.Body.Bytes()))
+	sr.StrictChecksum = true
+	sr.Password = func(_ *httpzip.Entry) (string, error) { return "secret", nil }
+
+	entries, err := readAll(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !entries[0].Verified() {
+		t.Fatal("entry is not verified")
+	}
+}
+
+func TestStreamReader_Password_authenticationCode(t *testing.T) {
+	rw := httptest.NewRecorder()
+
+	h := httpzip.NewHandler("archive")
+	h.Encryption = &httpzip.Encryption{Password: "secret", Method: httpzip.AES256}
+
+	if err := h.AddFile(httpzip.FileSource{
+		Path: "a.txt",
+		Size: 5,
+		Data: func(w io.Writer) error {
+			_, err := w.Write([]byte("hello"))
+
+			return err
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	h.ServeHTTP(rw, nil)
+
+	zr, err := zip.NewReader(bytes.NewReader(rw.Body.Bytes()), int64(rw.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offset, err := zr.File[0].DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	end := offset + int64(zr.File[0].CompressedSize64)
+
+	read := func(archive []byte) error {
+		sr := httpzip.NewStreamReader(bytes.NewReader(archive))
+		sr.Password = func(_ *httpzip.Entry) (string, error) { return "secret", nil }
+
+		e, err := sr.Next()
+		if err != nil {
+			return err
+		}
+
+		rc, err := e.Open()
+		if err != nil {
+			return err
+		}
+
+		_, err = io.ReadAll(rc)
+
+		return err
+	}
+
+	tampered := bytes.Clone(rw.Body.Bytes())
+	tampered[end-1] ^= 0xff
+
+	var ce *httpzip.ChecksumError
+	if err := read(tampered); !errors.As(err, &ce) || ce.Entry != "a.txt" || !errors.Is(err, zip.ErrChecksum) {
+		t.Fatalf("checksum error expected, got %v", err)
+	}
+
+	var fe *httpzip.FormatError
+	if err := read(rw.Body.Bytes()[:end-5]); !errors.As(err, &fe) || fe.Record != httpzip.RecordEncryptionTrailer ||
+		fe.Entry != "a.txt" || fe.Offset != end-10 {
+		t.Fatalf("format error expected, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package httpzip
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Errors of StreamReader.
+var (
+	// ErrEncrypted is matched by errors of encrypted entries that could not be decrypted.
+	ErrEncrypted = errors.New("entry is encrypted")
+
+	// ErrUnsupportedMethod is matched by *UnsupportedMethodError and zip.ErrAlgorithm.
+	ErrUnsupportedMethod = errors.New("unsupported compression method")
+
+	// ErrEntryConsumed is returned when entry is opened after its data was read or skipped.
+	ErrEntryConsumed = errors.New("entry data is already consumed")
+
+	// ErrEntryOpened is returned when entry is opened twice.
+	ErrEntryOpened = errors.New("entry is already opened")
+
+	// ErrEntryClosed is returned when entry data is read after it was closed.
+	ErrEntryClosed = errors.New("entry is already closed")
+
+	// ErrUnverified is matched by *UnverifiedError.
+	ErrUnverified = errors.New("checksum can not be verified")
+)
+
+// RecordType names a structure of ZIP stream.
+type RecordType string
+
+// Record types.
+const (
+	RecordSignature          = RecordType("signature")
+	RecordLocalHeader        = RecordType("local file header")
+	RecordExtraField         = RecordType("extra field")
+	RecordEncryptionHeader   = RecordType("encryption header")
+	RecordEncryptionTrailer  = RecordType("encryption trailer")
+	RecordFileData           = RecordType("file data")
+	RecordDataDescriptor     = RecordType("data descriptor")
+	RecordCentralDirectory   = RecordType("central directory")
+	RecordDirectory64End     = RecordType("zip64 end of central directory")
+	RecordDirectory64Locator = RecordType("zip64 end of central directory locator")
+	RecordDirectoryEnd       = RecordType("end of central directory")
+)
+
+// FormatError describes malformed or truncated record, it matches zip.ErrFormat.
+type FormatError struct {
+	Offset int64  // Stream offset of the record.
+	Entry  string // Entry name, empty for records outside of entries.
+	Record RecordType
+	Err    error // Cause, for example io.ErrUnexpectedEOF.
+}
+
+func (e *FormatError) Error() string {
+	s := fmt.Sprintf("zip: invalid %s at offset %d", e.Record, e.Offset)
+
+	if e.Entry != "" {
+		s += " of " + e.Entry
+	}
+
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+
+	return s
+}
+
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches zip.ErrFormat.
+func (e *FormatError) Is(target error) bool {
+	return target == zip.ErrFormat
+}
+
+// ChecksumError describes CRC32 or AES authentication code mismatch, it matches zip.ErrChecksum.
+type ChecksumError struct {
+	Entry    string
+	Expected uint32 // CRC32 from header or data descriptor, or leading bytes of stored authentication code.
+	Actual   uint32 // CRC32 of data, or of data descriptor if it differs from header, or of calculated authentication code.
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("zip: checksum error in %s: expected %08x, actual %08x", e.Entry, e.Expected, e.Actual)
+}
+
+// Is matches zip.ErrChecksum.
+func (e *ChecksumError) Is(target error) bool {
+	return target == zip.ErrChecksum
+}
+
+// UnverifiedError describes entry that could not be verified in strict checksum mode.
+type UnverifiedError struct {
+	Entry string
+	Err   error // Reason, for example ErrPasswordRequired.
+}
+
+func (e *UnverifiedError) Error() string {
+	return fmt.Sprintf("zip: checksum of %s can not be verified: %s", e.Entry, e.Err)
+}
+
+func (e *UnverifiedError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches ErrUnverified.
+func (e *UnverifiedError) Is(target error) bool {
+	return target == ErrUnverified
+}
+
+// UnsupportedMethodError describes compression method without registered decompressor.
+type UnsupportedMethodError struct {
+	Entry  string
+	Method uint16
+}
+
+func (e *UnsupportedMethodError) Error() string {
+	return fmt.Sprintf("zip: unsupported compression method %d in %s", e.Method, e.Entry)
+}
+
+// Is matches ErrUnsupportedMethod and zip.ErrAlgorithm.
+func (e *UnsupportedMethodError) Is(target error) bool {
+	return target == ErrUnsupportedMethod || target == zip.ErrAlgorithm
+}
+
+// readError returns *FormatError for truncated stream and err for other read failures.
+func readError(offset int64, entry string, record RecordType, err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &FormatError{Offset: offset, Entry: entry, Record: record, Err: io.ErrUnexpectedEOF}
+	}
+
+	return err
+}
@@ -0,0 +1,108 @@
+package httpzip_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/vearutop/httpzip"
+)
+
+func TestStreamReader_Next_formatError(t *testing.T) {
+	archive := zipFiles(t, "a.txt", "b.txt")
+	second := int64(bytes.LastIndex(archive[:bytes.Index(archive, []byte("PK\x01\x02"))], []byte("PK\x03\x04")))
+
+	for _, tc := range []struct {
+		name   string
+		data   []byte
+		offset int64
+		record httpzip.RecordType
+		cause  error
+	}{
+		{
+			name:   "truncated header",
+			data:   archive[:second+10],
+			offset: second,
+			record: httpzip.RecordLocalHeader,
+			cause:  io.ErrUnexpectedEOF,
+		},
+		{
+			name:   "bad signature",
+			data:   append(append(append([]byte{}, archive[:second]...), "PK\x05\x05"...), archive[second+4:]...),
+			offset: second,
+			record: httpzip.RecordSignature,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := readAll(httpzip.NewStreamReader(bytes.NewReader(tc.data)))
+
+			var fe *httpzip.FormatError
+			if !errors.As(err, &fe) || !errors.Is(err, zip.ErrFormat) {
+				t.Fatalf("format error expected, got %v", err)
+			}
+
+			if fe.Offset != tc.offset || fe.Record != tc.record {
+				t.Fatalf("unexpected error details: %+v", fe)
+			}
+
+			if tc.cause != nil && !errors.Is(err, tc.cause) {
+				t.Fatalf("%v expected, got %v", tc.cause, err)
+			}
+		})
+	}
+}
+
+func TestEntry_Open_checksumError(t *testing.T) {
+	archive := zipArchive(t, zipEntry{name: "a.txt", data: []byte("hello"), method: zip.Deflate})
+	archive[bytes.Index(archive, []byte("hello"))] = 'j'
+
+	sr := httpzip.NewStreamReader(bytes.NewReader(archive))
+
+	e, err := sr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := e.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = io.Copy(io.Discard, rc)
+
+	var ce *httpzip.ChecksumError
+	if !errors.As(err, &ce) || !errors.Is(err, zip.ErrChecksum) {
+		t.Fatalf("checksum error expected, got %v", err)
+	}
+
+	if ce.Entry != "a.txt" || ce.Expected == ce.Actual {
+		t.Fatalf("unexpected error details: %+v", ce)
+	}
+}
+
+func TestEntry_Open_unsupportedMethod(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := zip.NewWriter(buf)
+
+	if _, err := w.CreateRaw(&zip.FileHeader{Name: "a.lzma", Method: httpzip.LZMA}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := httpzip.NewStreamReader(bytes.NewReader(buf.Bytes())).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = e.Open()
+
+	var ue *httpzip.UnsupportedMethodError
+	if !errors.As(err, &ue) || ue.Method != httpzip.LZMA || !errors.Is(err, httpzip.ErrUnsupportedMethod) {
+		t.Fatalf("unsupported method error expected, got %v", err)
+	}
+}
@@ -0,0 +1,370 @@
+package httpzip
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConflictPolicy defines how extraction handles existing files.
+type ConflictPolicy int
+
+// Conflict policies.
+const (
+	ConflictError     ConflictPolicy = iota // Fail extraction, default.
+	ConflictOverwrite                       // Replace existing file.
+	ConflictSkip                            // Keep existing file and skip entry.
+	ConflictRename                          // Extract entry with a suffixed name, e.g. "file (1).txt".
+)
+
+// ErrFileExists is returned for existing files with ConflictError policy.
+var ErrFileExists = errors.New("file already exists")
+
+// ExtractOptions controls extraction to file system.
+type ExtractOptions struct {
+	Conflict ConflictPolicy
+
+	// Filter skips entries if it returns false.
+	Filter func(e *Entry) bool
+
+	// Fsync enables syncing of extracted files to storage before they are renamed to their final names.
+	Fsync bool
+
+	// FileMode and DirMode are used if entry has no permissions, defaults are 0644 and 0755.
+	// Local file headers have no permissions, so files get permissions from central directory
+	// after all entries are extracted if StreamReader.ReadCentralDirectory is enabled, otherwise FileMode is used.
+	FileMode fs.FileMode
+	DirMode  fs.FileMode
+
+	// PreserveOwner sets owner of extracted files from Unix extra fields, it usually requires root privileges.
+	PreserveOwner bool
+
+	// OnError is called for entry that failed extraction, extraction continues with the next entry
+	// if it returns nil. Extraction stops at the first failed entry by default.
+	OnError func(e *Entry, err error) error
+}
+
+// ExtractedFile describes an extracted entry.
+type ExtractedFile struct {
+	Name    string // Entry name.
+	Path    string // File system path, may differ from entry name with ConflictRename policy.
+	Dir     bool
+	Skipped bool // Entry was skipped due to existing file.
+	Size    uint64
+	CRC32   uint32
+}
+
+// ExtractReport lists extracted entries.
+type ExtractReport struct {
+	Files []ExtractedFile
+}
+
+// Extract writes remaining entries to the root directory.
+//
+// Entries that point outside of root, either by name or through existing symlinks,
+// fail extraction with zip.ErrInsecurePath. Files are written to temporary files
+// and renamed when complete, so failed extraction does not leave partial files.
+// Report contains entries that were processed before an error.
+func (z *StreamReader) Extract(root string, opts ExtractOptions) (*ExtractReport, error) {
+	if opts.FileMode == 0 {
+		opts.FileMode = 0o644
+	}
+
+	if opts.DirMode == 0 {
+		opts.DirMode = 0o755
+	}
+
+	x := extraction{root: root, opts: opts, report: &ExtractReport{}}
+
+	for {
+		e, err := z.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return x.report, err
+		}
+
+		if opts.Filter != nil && !opts.Filter(e) {
+			continue
+		}
+
+		if err := x.entry(e); err != nil {
+			err = fmt.Errorf("extract %s: %w", e.Name, err)
+
+			if opts.OnError == nil {
+				return x.report, err
+			}
+
+			if err := opts.OnError(e, err); err != nil {
+				return x.report, err
+			}
+		}
+	}
+
+	// Permissions of entries are only known after central directory is read.
+	if z.directory != nil {
+		for _, f := range x.files {
+			if err := os.Chmod(f.path, x.fileMode(f.entry)); err != nil {
+				return x.report, err
+			}
+		}
+	}
+
+	// Directory times are restored after their contents are written.
+	for i := len(x.dirTimes) - 1; i >= 0; i-- {
+		dt := x.dirTimes[i]
+		if err := os.Chtimes(dt.path, dt.modified, dt.modified); err != nil {
+			return x.report, err
+		}
+	}
+
+	return x.report, nil
+}
+
+type dirTime struct {
+	path     string
+	modified time.Time
+}
+
+type extractedEntry struct {
+	path  string
+	entry *Entry
+}
+
+type extraction struct {
+	root     string
+	opts     ExtractOptions
+	report   *ExtractReport
+	dirTimes []dirTime
+	files    []extractedEntry
+}
+
+func (x *extraction) entry(e *Entry) error {
+	fn, err := securePath(x.root, e.Name)
+	if err != nil {
+		return err
+	}
+
+	if e.IsDir() {
+		if err := x.mkdirAll(fn); err != nil {
+			return err
+		}
+
+		if !e.Modified.IsZero() {
+			x.dirTimes = append(x.dirTimes, dirTime{path: fn, modified: e.Modified})
+		}
+
+		x.report.Files = append(x.report.Files, ExtractedFile{Name: e.Name, Path: fn, Dir: true})
+
+		return nil
+	}
+
+	if err := x.mkdirAll(filepath.Dir(fn)); err != nil {
+		return err
+	}
+
+	fn, skip, err := x.resolveConflict(fn)
+	if err != nil {
+		return err
+	}
+
+	if skip {
+		x.report.Files = append(x.report.Files, ExtractedFile{Name: e.Name, Path: fn, Skipped: true})
+
+		return nil
+	}
+
+	ef, err := x.writeFile(e, fn)
+	if err != nil {
+		return err
+	}
+
+	x.report.Files = append(x.report.Files, ef)
+	x.files = append(x.files, extractedEntry{path: ef.Path, entry: e})
+
+	return nil
+}
+
+func (x *extraction) resolveConflict(fn string) (string, bool, error) {
+	fi, err := os.Lstat(fn)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fn, false, nil
+	}
+
+	if err != nil {
+		return "", false, err
+	}
+
+	switch x.opts.Conflict {
+	case ConflictSkip:
+		return fn, true, nil
+	case ConflictOverwrite:
+		if fi.IsDir() {
+			return "", false, fmt.Errorf("%w: %s is a directory", ErrFileExists, fn)
+		}
+
+		return fn, false, nil
+	case ConflictRename:
+		ext := filepath.Ext(fn)
+		base := strings.TrimSuffix(fn, ext)
+
+		for i := 1; ; i++ {
+			candidate := base + " (" + strconv.Itoa(i) + ")" + ext
+			if _, err := os.Lstat(candidate); errors.Is(err, fs.ErrNotExist) {
+				return candidate, false, nil
+			} else if err != nil {
+				return "", false, err
+			}
+		}
+	default:
+		return "", false, fmt.Errorf("%w: %s", ErrFileExists, fn)
+	}
+}
+
+func (x *extraction) writeFile(e *Entry, fn string) (ExtractedFile, error) {
+	ef := ExtractedFile{Name: e.Name, Path: fn}
+
+	rc, err := e.Open()
+	if err != nil {
+		return ef, err
+	}
+	defer rc.Close() //nolint:errcheck // Decompressor close error is irrelevant.
+
+	f, err := os.CreateTemp(filepath.Dir(fn), "."+filepath.Base(fn)+".*.tmp")
+	if err != nil {
+		return ef, err
+	}
+
+	tmp := f.Name()
+
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	h := crc32.NewIEEE()
+
+	n, err := io.Copy(io.MultiWriter(f, h), rc)
+	if err != nil {
+		return ef, err
+	}
+
+	ef.Size = uint64(n)
+	ef.CRC32 = h.Sum32()
+
+	if x.opts.Fsync {
+		if err = f.Sync(); err != nil {
+			return ef, err
+		}
+	}
+
+	if err = f.Close(); err != nil {
+		return ef, err
+	}
+
+	if err = os.Chmod(tmp, x.fileMode(e)); err != nil {
+		return ef, err
+	}
+
+	md := e.Metadata()
+
+	if !e.Modified.IsZero() {
+		atime := e.Modified
+		if ts, ok := md.Time(TimeAccessed); ok {
+			atime = ts.Time
+		}
+
+		if err = os.Chtimes(tmp, atime, e.Modified); err != nil {
+			return ef, err
+		}
+	}
+
+	if x.opts.PreserveOwner && md.Owner != nil {
+		if err = os.Lchown(tmp, int(md.Owner.UID), int(md.Owner.GID)); err != nil {
+			return ef, err
+		}
+	}
+
+	// Rename replaces existing symlink instead of following it.
+	err = os.Rename(tmp, fn)
+
+	return ef, err
+}
+
+func (x *extraction) fileMode(e *Entry) fs.FileMode {
+	// Permissions are only available from central directory or Unix extra fields.
+	if e.ExternalAttrs == 0 {
+		return x.opts.FileMode
+	}
+
+	if perm := e.Mode().Perm(); perm != 0 {
+		return perm
+	}
+
+	return x.opts.FileMode
+}
+
+// mkdirAll creates directory and its parents, existing symlinks are not followed.
+func (x *extraction) mkdirAll(dir string) error {
+	rel, err := filepath.Rel(x.root, dir)
+	if err != nil {
+		return err
+	}
+
+	p := x.root
+
+	if err := os.MkdirAll(p, x.opts.DirMode); err != nil || rel == "." {
+		return err
+	}
+
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		p = filepath.Join(p, part)
+
+		fi, err := os.Lstat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			if err := os.MkdirAll(p, x.opts.DirMode); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %s is a symlink", zip.ErrInsecurePath, p)
+		}
+
+		if !fi.IsDir() {
+			return fmt.Errorf("%s is not a directory", p)
+		}
+	}
+
+	return nil
+}
+
+// securePath returns file system path of entry under root,
+// it fails if entry name is absolute or has parent directory references.
+func securePath(root, name string) (string, error) {
+	n := filepath.FromSlash(strings.TrimSuffix(name, "/"))
+
+	if n == "" || strings.ContainsRune(name, 0) || !filepath.IsLocal(n) {
+		return "", fmt.Errorf("%w: %q", zip.ErrInsecurePath, name)
+	}
+
+	return filepath.Join(root, n), nil
+}
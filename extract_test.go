@@ -0,0 +1,216 @@
+package httpzip_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vearutop/httpzip"
+)
+
+func zipFiles(t *testing.T, files ...string) []byte {
+	t.Helper()
+
+	entries := make([]zipEntry, 0, len(files))
+	for _, name := range files {
+		entries = append(entries, zipEntry{name: name, data: []byte("content of " + name), method: zip.Deflate})
+	}
+
+	return zipArchive(t, entries...)
+}
+
+func TestStreamReader_Extract(t *testing.T) {
+	root := t.TempDir()
+
+	sr := httpzip.NewStreamReader(bytes.NewReader(zipFiles(t, "a.txt", "dir/b.txt")))
+
+	report, err := sr.Extract(root, httpzip.ExtractOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Files) != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	for _, f := range report.Files {
+		content := "content of " + f.Name
+
+		b, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(f.Name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != content || f.Size != uint64(len(content)) || f.CRC32 != crc32.ChecksumIEEE(b) {
+			t.Fatalf("unexpected file %+v: %q", f, b)
+		}
+	}
+}
+
+func TestStreamReader_Extract_insecurePath(t *testing.T) {
+	for _, name := range []string{"../x.txt", "dir/../../x.txt", "/abs.txt"} {
+		t.Run(name, func(t *testing.T) {
+			root := filepath.Join(t.TempDir(), "out")
+
+			sr := httpzip.NewStreamReader(bytes.NewReader(zipFiles(t, name)))
+
+			_, err := sr.Extract(root, httpzip.ExtractOptions{})
+			if !errors.Is(err, zip.ErrInsecurePath) {
+				t.Fatalf("insecure path expected, got %v", err)
+			}
+
+			if _, err := os.Stat(filepath.Join(root, "..", "x.txt")); err == nil {
+				t.Fatal("file written outside of root")
+			}
+		})
+	}
+}
+
+func TestStreamReader_Extract_symlink(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skip(err)
+	}
+
+	sr := httpzip.NewStreamReader(bytes.NewReader(zipFiles(t, "link/x.txt")))
+
+	_, err := sr.Extract(root, httpzip.ExtractOptions{})
+	if !errors.Is(err, zip.ErrInsecurePath) {
+		t.Fatalf("insecure path expected, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "x.txt")); err == nil {
+		t.Fatal("file written through symlink")
+	}
+}
+
+func TestStreamReader_Extract_conflict(t *testing.T) {
+	for _, tc := range []struct {
+		policy  httpzip.ConflictPolicy
+		err     error
+		path    string
+		content string
+		skipped bool
+	}{
+		{policy: httpzip.ConflictError, err: httpzip.ErrFileExists, path: "a.txt", content: "old"},
+		{policy: httpzip.ConflictSkip, path: "a.txt", content: "old", skipped: true},
+		{policy: httpzip.ConflictOverwrite, path: "a.txt", content: "content of a.txt"},
+		{policy: httpzip.ConflictRename, path: "a (1).txt", content: "content of a.txt"},
+	} {
+		root := t.TempDir()
+		existing := filepath.Join(root, "a.txt")
+
+		if err := os.WriteFile(existing, []byte("old"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		sr := httpzip.NewStreamReader(bytes.NewReader(zipFiles(t, "a.txt")))
+
+		report, err := sr.Extract(root, httpzip.ExtractOptions{Conflict: tc.policy})
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("policy %d: unexpected error %v", tc.policy, err)
+		}
+
+		if tc.err != nil {
+			continue
+		}
+
+		if len(report.Files) != 1 || report.Files[0].Skipped != tc.skipped ||
+			report.Files[0].Path != filepath.Join(root, tc.path) {
+			t.Fatalf("policy %d: unexpected report %+v", tc.policy, report.Files)
+		}
+
+		b, err := os.ReadFile(filepath.Join(root, tc.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != tc.content {
+			t.Fatalf("policy %d: unexpected content %q", tc.policy, b)
+		}
+	}
+}
+
+func TestStreamReader_Extract_mode(t *testing.T) {
+	archive := zipArchive(t, zipEntry{name: "script.sh", data: []byte("#!/bin/sh"), method: zip.Deflate, mode: 0o750})
+
+	for _, central := range []bool{false, true} {
+		root := t.TempDir()
+
+		sr := httpzip.NewStreamReader(bytes.NewReader(archive))
+		sr.ReadCentralDirectory = central
+
+		if _, err := sr.Extract(root, httpzip.ExtractOptions{FileMode: 0o600}); err != nil {
+			t.Fatal(err)
+		}
+
+		fi, err := os.Stat(filepath.Join(root, "script.sh"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Permissions are only available in central directory.
+		expected := os.FileMode(0o600)
+		if central {
+			expected = 0o750
+		}
+
+		if fi.Mode().Perm() != expected {
+			t.Fatalf("unexpected mode %s, central directory %v", fi.Mode(), central)
+		}
+	}
+}
+
+func TestStreamReader_Extract_onError(t *testing.T) {
+	h := httpzip.NewHandler("archive")
+	h.Streamable = true
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := h.AddFile(httpzip.FileSource{
+			Path:  name,
+			Size:  int64(len(name)),
+			CRC32: 1, // Does not match data.
+			Data: func(w io.Writer) error {
+				_, err := w.Write([]byte(name))
+
+				return err
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, nil)
+
+	var failed []string
+
+	sr := httpzip.NewStreamReader(bytes.NewReader(rw.Body.Bytes()))
+
+	report, err := sr.Extract(t.TempDir(), httpzip.ExtractOptions{
+		OnError: func(e *httpzip.Entry, err error) error {
+			if !errors.Is(err, zip.ErrChecksum) {
+				return err
+			}
+
+			failed = append(failed, e.Name)
+
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(failed) != 2 || len(report.Files) != 0 {
+		t.Fatalf("unexpected failed entries %v, report %+v", failed, report)
+	}
+}
@@ -0,0 +1,262 @@
+package httpzip
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Format is an archive format.
+type Format string
+
+// Archive formats.
+const (
+	FormatZip   = Format("zip")
+	FormatTar   = Format("tar")
+	FormatTarGz = Format("tar.gz")
+)
+
+// ContentType returns MIME type of format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatTar:
+		return "application/x-tar"
+	case FormatTarGz:
+		return "application/gzip"
+	default:
+		return "application/zip"
+	}
+}
+
+// ErrUnsupportedFormat is returned for requested format that is not available.
+var ErrUnsupportedFormat = errors.New("unsupported archive format")
+
+// parseFormat returns format by name or file extension.
+func parseFormat(name string) (Format, bool) {
+	switch strings.ToLower(name) {
+	case "zip":
+		return FormatZip, true
+	case "tar":
+		return FormatTar, true
+	case "tar.gz", "tgz":
+		return FormatTarGz, true
+	default:
+		return "", false
+	}
+}
+
+// acceptFormats maps MIME types of Accept header to formats.
+var acceptFormats = map[string]Format{
+	"application/zip":              FormatZip,
+	"application/x-zip-compressed": FormatZip,
+	"application/x-tar":            FormatTar,
+	"application/gzip":             FormatTarGz,
+	"application/x-gzip":           FormatTarGz,
+	"application/x-tgz":            FormatTarGz,
+}
+
+// negotiateFormat selects format with "format" query parameter, URL path extension or Accept header,
+// first of available formats is used by default.
+func negotiateFormat(r *http.Request, available []Format) (Format, error) {
+	if len(available) == 1 || r == nil {
+		return available[0], nil
+	}
+
+	explicit := func(f Format) (Format, error) {
+		if !slices.Contains(available, f) {
+			return "", fmt.Errorf("%w: %s", ErrUnsupportedFormat, f)
+		}
+
+		return f, nil
+	}
+
+	if name := r.URL.Query().Get("format"); name != "" {
+		f, ok := parseFormat(name)
+		if !ok {
+			return "", fmt.Errorf("%w: %s", ErrUnsupportedFormat, name)
+		}
+
+		return explicit(f)
+	}
+
+	p := strings.ToLower(r.URL.Path)
+
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(p, ext) {
+			f, _ := parseFormat(ext[1:])
+
+			return explicit(f)
+		}
+	}
+
+	best, bestQ := available[0], 0.0
+	listed := false
+
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+
+		f, ok := acceptFormats[strings.ToLower(strings.TrimSpace(mediaType))]
+		if !ok || !slices.Contains(available, f) {
+			continue
+		}
+
+		q := 1.0
+
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if q, _ = strconv.ParseFloat(v, 64); q > 1 {
+					q = 1
+				}
+			}
+		}
+
+		listed = true
+
+		if q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+
+	// Formats with q=0 are not acceptable, default is only used if none of formats is listed.
+	if listed && bestQ == 0 {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedFormat, r.Header.Get("Accept"))
+	}
+
+	return best, nil
+}
+
+// serveSized serves archive of known size with optional single byte range,
+// ranges are disabled for archives that differ between writes.
+func serveSized(rw http.ResponseWriter, r *http.Request, size int64, ranges bool, write func(w io.Writer) error) error {
+	start, length := int64(0), size
+
+	if ranges {
+		rw.Header().Set("Accept-Ranges", "bytes")
+
+		var err error
+
+		if start, length, err = parseRange(r, size); err != nil {
+			rw.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			http.Error(rw, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+
+			return nil
+		}
+	}
+
+	if length == size {
+		rw.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+
+		if r != nil && r.Method == http.MethodHead {
+			return nil
+		}
+
+		return write(rw)
+	}
+
+	rw.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	rw.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+	rw.WriteHeader(http.StatusPartialContent)
+
+	if r.Method == http.MethodHead {
+		return nil
+	}
+
+	err := write(&rangeWriter{w: rw, skip: start, left: length})
+	if errors.Is(err, errRangeWritten) {
+		err = nil
+	}
+
+	return err
+}
+
+// errRangeWritten stops writing of archive after the end of requested range.
+var errRangeWritten = errors.New("range written")
+
+// rangeWriter passes through a range of written bytes.
+type rangeWriter struct {
+	w    io.Writer
+	skip int64
+	left int64
+}
+
+func (r *rangeWriter) Write(p []byte) (int, error) {
+	n := len(p)
+
+	if r.skip >= int64(len(p)) {
+		r.skip -= int64(len(p))
+
+		return n, nil
+	}
+
+	p = p[r.skip:]
+	r.skip = 0
+
+	if int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+
+	if _, err := r.w.Write(p); err != nil {
+		return 0, err
+	}
+
+	r.left -= int64(len(p))
+
+	if r.left == 0 {
+		return n, errRangeWritten
+	}
+
+	return n, nil
+}
+
+// parseRange returns a single byte range of request, multiple ranges and conditional ranges are served in full.
+func parseRange(r *http.Request, size int64) (start, length int64, err error) {
+	if r == nil || r.Header.Get("If-Range") != "" {
+		return 0, size, nil
+	}
+
+	spec, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, size, nil
+	}
+
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, size, nil
+	}
+
+	errRange := fmt.Errorf("invalid range %q", spec)
+
+	if first == "" {
+		// Suffix range, last bytes.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, errRange
+		}
+
+		n = min(n, size)
+
+		return size - n, n, nil
+	}
+
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, errRange
+	}
+
+	end := size - 1
+
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, errRange
+		}
+
+		end = min(end, size-1)
+	}
+
+	return start, end - start + 1, nil
+}
@@ -0,0 +1,223 @@
+package httpzip_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vearutop/httpzip"
+)
+
+func formatsHandler(t *testing.T) *httpzip.Handler {
+	t.Helper()
+
+	h := httpzip.NewHandler("archive")
+	h.OnError = func(err error) {
+		t.Error(err)
+	}
+
+	data := func(s string) func(w io.Writer) error {
+		return func(w io.Writer) error {
+			_, err := w.Write([]byte(s))
+
+			return err
+		}
+	}
+
+	long := strings.Repeat("long/", 30) + "name.txt" // Needs PAX header.
+	content := strings.Repeat("raw ", 1000)
+	compressed := bytes.NewBuffer(nil)
+	fw, _ := flate.NewWriter(compressed, flate.BestCompression)
+	_, _ = fw.Write([]byte(content))
+	_ = fw.Close()
+
+	for _, fs := range []httpzip.FileSource{
+		{Path: "dir/", Mode: fs.ModeDir | 0o700, Data: data("")},
+		{Path: "dir/a.txt", Size: 5, Modified: time.Date(2024, 1, 2, 3, 4, 5, 600, time.UTC), Data: data("hello")},
+		{Path: "dir/link", Size: 5, Mode: fs.ModeSymlink | 0o777, Data: data("a.txt")},
+		{Path: long, Size: 4, Data: data("long")},
+		{
+			Path: "raw.txt", Size: int64(len(content)), CRC32: crc32.ChecksumIEEE([]byte(content)),
+			Raw: true, Method: 8, CompressedSize: int64(compressed.Len()), Data: data(compressed.String()),
+		},
+	} {
+		if err := h.AddFile(fs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return h
+}
+
+func TestHandler_ServeHTTP_formats(t *testing.T) {
+	h := formatsHandler(t)
+
+	for _, tc := range []struct {
+		url         string
+		accept      string
+		contentType string
+		filename    string
+		status      int
+	}{
+		{url: "/download", contentType: "application/zip", filename: "archive.zip"},
+		{url: "/download?format=tar", contentType: "application/x-tar", filename: "archive.tar"},
+		{url: "/download.tgz", contentType: "application/gzip", filename: "archive.tar.gz"},
+		{url: "/download.TAR", accept: "application/zip", contentType: "application/x-tar", filename: "archive.tar"},
+		{url: "/download", accept: "application/zip;q=0.5, application/x-tar", contentType: "application/x-tar", filename: "archive.tar"},
+		{url: "/download", accept: "text/html, */*", contentType: "application/zip", filename: "archive.zip"},
+		{url: "/download", accept: "application/zip;q=0, application/x-tar;q=0.1", contentType: "application/x-tar", filename: "archive.tar"},
+		{url: "/download", accept: "application/zip;q=0", status: http.StatusNotAcceptable},
+		{url: "/download?format=rar", status: http.StatusNotAcceptable},
+	} {
+		t.Run(tc.url+" "+tc.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			req.Header.Set("Accept", tc.accept)
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+
+			if tc.status != 0 {
+				if rw.Code != tc.status {
+					t.Fatalf("unexpected status: %d", rw.Code)
+				}
+
+				return
+			}
+
+			if rw.Header().Get("Content-Type") != tc.contentType ||
+				rw.Header().Get("Content-Disposition") != `attachment; filename="`+tc.filename+`"` {
+				t.Fatalf("unexpected headers: %v", rw.Header())
+			}
+
+			body := io.Reader(rw.Body)
+
+			switch tc.contentType {
+			case "application/zip":
+				return
+			case "application/gzip":
+				if rw.Header().Get("Content-Length") != "" {
+					t.Fatal("unexpected Content-Length")
+				}
+
+				gr, err := gzip.NewReader(rw.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				body = gr
+			default:
+				if rw.Header().Get("Content-Length") != strconv.Itoa(rw.Body.Len()) {
+					t.Fatalf("unexpected Content-Length: %s, %d", rw.Header().Get("Content-Length"), rw.Body.Len())
+				}
+			}
+
+			headers, contents := readTar(t, body)
+
+			if len(headers) != 5 || headers["dir/"].Mode != 0o700 || headers["dir/link"].Linkname != "a.txt" ||
+				!headers["dir/a.txt"].ModTime.Equal(time.Date(2024, 1, 2, 3, 4, 5, 600, time.UTC)) {
+				t.Fatalf("unexpected headers: %v", headers)
+			}
+
+			if contents["raw.txt"] != strings.Repeat("raw ", 1000) || contents["dir/a.txt"] != "hello" {
+				t.Fatal("unexpected contents")
+			}
+		})
+	}
+
+	// Tar has no encryption.
+	h = httpzip.NewHandler("secret")
+	h.Encryption = &httpzip.Encryption{Password: "secret"}
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/download.tar", nil))
+
+	if rw.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("unexpected Content-Type: %s", rw.Header().Get("Content-Type"))
+	}
+}
+
+func TestHandler_ServeHTTP_range(t *testing.T) {
+	h := formatsHandler(t)
+
+	for _, url := range []string{"/download.zip", "/download.tar"} {
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, url, nil))
+
+		full := rw.Body.Bytes()
+		size := strconv.Itoa(len(full))
+
+		for _, tc := range []struct {
+			rng      string
+			status   int
+			expected []byte
+		}{
+			{rng: "bytes=10-99", status: http.StatusPartialContent, expected: full[10:100]},
+			{rng: "bytes=500-", status: http.StatusPartialContent, expected: full[500:]},
+			{rng: "bytes=-30", status: http.StatusPartialContent, expected: full[len(full)-30:]},
+			{rng: "bytes=0-0,5-6", status: http.StatusOK, expected: full},
+			{rng: "bytes=" + size + "-", status: http.StatusRequestedRangeNotSatisfiable},
+		} {
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			req.Header.Set("Range", tc.rng)
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+
+			if rw.Code != tc.status {
+				t.Fatalf("%s %s: unexpected status %d", url, tc.rng, rw.Code)
+			}
+
+			if tc.expected != nil && !bytes.Equal(rw.Body.Bytes(), tc.expected) {
+				t.Fatalf("%s %s: unexpected body", url, tc.rng)
+			}
+
+			if tc.expected != nil && rw.Header().Get("Content-Length") != strconv.Itoa(len(tc.expected)) {
+				t.Fatalf("%s %s: unexpected Content-Length %s", url, tc.rng, rw.Header().Get("Content-Length"))
+			}
+		}
+	}
+}
+
+func TestHandler_ServeHTTP_rangeEncrypted(t *testing.T) {
+	h := httpzip.NewHandler("secret")
+	h.Encryption = &httpzip.Encryption{Password: "secret"}
+	h.OnError = func(err error) {
+		t.Error(err)
+	}
+
+	if err := h.AddFile(httpzip.FileSource{
+		Path: "secret.txt",
+		Size: 5,
+		Data: func(w io.Writer) error {
+			_, err := w.Write([]byte("hello"))
+
+			return err
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/download.zip", nil)
+	req.Header.Set("Range", "bytes=10-99")
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+
+	// Encryption salt differs between responses, so that ranges can not be joined.
+	if rw.Code != http.StatusOK || rw.Header().Get("Accept-Ranges") != "" || rw.Header().Get("Content-Range") != "" {
+		t.Fatalf("unexpected response: %d %v", rw.Code, rw.Header())
+	}
+
+	if rw.Header().Get("Content-Length") != strconv.Itoa(rw.Body.Len()) {
+		t.Fatalf("unexpected Content-Length: %s, %d", rw.Header().Get("Content-Length"), rw.Body.Len())
+	}
+}
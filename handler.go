@@ -6,14 +6,17 @@ import (
 	"fmt"
 	"hash/crc32"
 	"io"
+	"io/fs"
 	"net/http"
-	"strconv"
+	"slices"
+	"sync"
 	"time"
 )
 
 // Handler serves multiple files in uncompressed ZIP.
 type Handler struct {
 	archiveName string
+	mu          sync.Mutex // Guards lazy calculation of archive sizes for concurrent requests.
 	tmp         *zip.Writer
 	closed      bool
 	totalBytes  *countingWriter
@@ -22,6 +25,17 @@ type Handler struct {
 	OnError     func(err error)
 	Streamable  bool // Use inlined raw file headers instead of final directory to allow streaming decoding.
 	IgnoreCRC32 bool // Allow streamable ZIP with empty CRC32.
+
+	// Encryption enables password protection for all entries, it must be set before adding files.
+	Encryption *Encryption
+
+	// Formats lists formats available for negotiation, first one is default, FormatZip, FormatTar and FormatTarGz
+	// are available if empty. Format is selected with "format" query parameter, URL path extension (".zip", ".tar",
+	// ".tar.gz", ".tgz") or Accept header. Tar formats are not available if any entry is encrypted.
+	Formats []Format
+
+	tarSize     int64
+	tarSizeDone bool
 }
 
 type countingWriter struct {
@@ -55,6 +69,37 @@ type FileSource struct {
 	Size     int64
 	CRC32    uint32 // CRC32 checksum of the file content, optional.
 	Data     func(w io.Writer) error
+
+	// Mode sets permissions and type of entry, optional. Directory needs fs.ModeDir and path with trailing slash,
+	// symlink needs fs.ModeSymlink and target as Data.
+	Mode fs.FileMode
+
+	// Comment and Extra fields of ZIP entry header, optional. Extra must not contain ZIP64 field,
+	// it is added by zip.Writer when necessary.
+	Comment string
+	Extra   []byte
+
+	// Encryption overrides Handler.Encryption for this entry, empty password disables encryption.
+	Encryption *Encryption
+
+	// Raw indicates that Data provides data compressed with Method, it is written with zip.Writer.CreateRaw
+	// without recompression, for example from Entry.OpenRaw. CompressedSize is required, as well as
+	// Size and CRC32 of uncompressed content.
+	Raw            bool
+	Method         uint16
+	CompressedSize int64
+
+	volatile bool      // Data differs between calls, so CRC32 can not be calculated in advance.
+	tar      *tarEntry // Data is copied from tar stream of write pass.
+}
+
+// dataSize returns size of data provided by Data.
+func (fs *FileSource) dataSize() int64 {
+	if fs.Raw {
+		return fs.CompressedSize
+	}
+
+	return fs.Size
 }
 
 // FillCRC32 counts CRC32 if it is empty.
@@ -63,6 +108,10 @@ func (fs *FileSource) FillCRC32() error {
 		return nil
 	}
 
+	if fs.volatile {
+		return fmt.Errorf("CRC32 can not be calculated for %s, its data differs between writes", fs.Path)
+	}
+
 	c := crc32.NewIEEE()
 	if err := fs.Data(c); err != nil {
 		return err
@@ -77,46 +126,32 @@ var tenK = make([]byte, 10000)
 
 // AddFile add a file to the archive.
 func (h *Handler) AddFile(fs FileSource) error {
-	var (
-		f   io.Writer
-		err error
-	)
-
-	if h.Streamable {
-		if fs.CRC32 == 0 && !h.IgnoreCRC32 {
-			if err := fs.FillCRC32(); err != nil {
-				return err
-			}
-		}
+	enc := h.encryption(fs)
 
-		f, err = h.tmp.CreateRaw(&zip.FileHeader{
-			Name:               fs.Path,
-			Method:             zip.Store,
-			Modified:           fs.Modified,
-			CompressedSize64:   uint64(fs.Size),
-			UncompressedSize64: uint64(fs.Size),
-			CRC32:              fs.CRC32,
-		})
-	} else {
-		f, err = h.tmp.CreateHeader(&zip.FileHeader{
-			Name:     fs.Path,
-			Method:   zip.Store,
-			Modified: fs.Modified,
-		})
+	if fs.Raw && fs.CRC32 == 0 && fs.Size > 0 {
+		return fmt.Errorf("CRC32 is required for raw file %s", fs.Path)
+	}
+
+	// ZipCrypto needs CRC32 to derive password check byte in streamable mode, AES does not store CRC32.
+	if h.Streamable && !fs.Raw && fs.CRC32 == 0 && ((enc == nil && !h.IgnoreCRC32) || enc.method() == ZipCrypto) {
+		if err := fs.FillCRC32(); err != nil {
+			return err
+		}
 	}
 
+	f, _, err := h.createEntry(h.tmp, fs)
 	if err != nil {
 		return err
 	}
 
-	size := int(fs.Size)
+	size := fs.dataSize() + enc.overhead()
 
-	for size > len(tenK) {
+	for size > int64(len(tenK)) {
 		if _, err := f.Write(tenK); err != nil {
 			return err
 		}
 
-		size -= len(tenK)
+		size -= int64(len(tenK))
 	}
 
 	if size > 0 {
@@ -130,64 +165,283 @@ func (h *Handler) AddFile(fs FileSource) error {
 	return nil
 }
 
-func (h *Handler) ServeHTTP(rw http.ResponseWriter, _ *http.Request) {
+func (h *Handler) encryption(fs FileSource) *Encryption {
+	enc := h.Encryption
+	if fs.Encryption != nil {
+		enc = fs.Encryption
+	}
+
+	// Directories have no data to encrypt.
+	if enc == nil || enc.Password == "" || fs.Mode.IsDir() {
+		return nil
+	}
+
+	return enc
+}
+
+// createEntry adds file header to the archive and returns writer for raw entry data.
+func (h *Handler) createEntry(w *zip.Writer, fs FileSource) (io.Writer, *zip.FileHeader, error) {
+	enc := h.encryption(fs)
+
+	if !h.Streamable && enc == nil && !fs.Raw {
+		fh := &zip.FileHeader{
+			Name:     fs.Path,
+			Method:   zip.Store,
+			Modified: fs.Modified,
+			Comment:  fs.Comment,
+			Extra:    fs.Extra,
+		}
+
+		if fs.Mode != 0 {
+			fh.SetMode(fs.Mode)
+		}
+
+		f, err := w.CreateHeader(fh)
+
+		return f, fh, err
+	}
+
+	fh := &zip.FileHeader{
+		Name:               fs.Path,
+		Method:             zip.Store,
+		Modified:           fs.Modified,
+		CompressedSize64:   uint64(fs.dataSize() + enc.overhead()),
+		UncompressedSize64: uint64(fs.Size),
+		CRC32:              fs.CRC32,
+		Comment:            fs.Comment,
+		Extra:              fs.Extra,
+	}
+
+	if fs.Raw {
+		fh.Method = fs.Method
+	}
+
+	if fs.Mode != 0 {
+		fh.SetMode(fs.Mode)
+	}
+
+	// Plain streamable entries keep header fields of earlier versions, so that their archives do not change.
+	if enc != nil || fs.Raw {
+		fh.ReaderVersion = zipVersion20
+
+		if !fs.Modified.IsZero() {
+			fh.ModifiedDate, fh.ModifiedTime = timeToMsDosTime(fs.Modified)
+		}
+	}
+
+	// Unlike CreateHeader, CreateRaw does not detect UTF-8 names.
+	if !isASCII(fs.Path) || !isASCII(fs.Comment) {
+		fh.Flags |= flagUTF8
+	}
+
+	if enc != nil {
+		fh.Flags |= 0x1
+
+		switch enc.Method {
+		case ZipCrypto:
+			if !h.Streamable && !fs.Raw {
+				// CRC32 is calculated while serving and is written to data descriptor.
+				fh.Flags |= 0x8
+			}
+		default:
+			fh.Extra = append(slices.Clip(fh.Extra), aesExtra(fh.Method)...)
+			fh.Method = methodWinZipAES
+			fh.ReaderVersion = zipVersion51
+			fh.CRC32 = 0
+		}
+	}
+
+	f, err := w.CreateRaw(fh)
+
+	return f, fh, err
+}
+
+// writeData writes file contents to the entry, encrypting them if necessary.
+func (h *Handler) writeData(f io.Writer, fh *zip.FileHeader, fs FileSource) error {
+	enc := h.encryption(fs)
+
+	switch {
+	case enc == nil:
+		return fs.Data(f)
+	case enc.Method == ZipCrypto:
+		check := byte(fh.CRC32 >> 24)
+		if fh.Flags&0x8 != 0 {
+			check = byte(fh.ModifiedTime >> 8)
+		}
+
+		zw, err := newZipCryptoWriter(f, enc.Password, check)
+		if err != nil {
+			return err
+		}
+
+		if fh.Flags&0x8 == 0 {
+			return fs.Data(zw)
+		}
+
+		c := crc32.NewIEEE()
+		if err := fs.Data(io.MultiWriter(zw, c)); err != nil {
+			return err
+		}
+
+		// Data descriptor is written from file header on next entry or archive close.
+		fh.CRC32 = c.Sum32()
+
+		return nil
+	default:
+		aw, err := newAESWriter(f, enc.Password)
+		if err != nil {
+			return err
+		}
+
+		if err := fs.Data(aw); err != nil {
+			return err
+		}
+
+		return aw.Close()
+	}
+}
+
+// Size returns length of ZIP archive, files can not be added after it is called.
+func (h *Handler) Size() (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
 	if !h.closed {
 		if err := h.tmp.Close(); err != nil {
+			return 0, err
+		}
+
+		h.closed = true
+	}
+
+	return h.totalBytes.written, nil
+}
+
+// FileSource returns ZIP archive as a source of entry for another Handler, files can not be added after it is called.
+//
+// Size of the source is exact length of the archive, CRC32 is calculated by generating the archive if outer Handler
+// needs it (for example, if it is Streamable). Encrypted entries have random salt, so such archive can only
+// be nested into Handler that does not need CRC32 in advance, AddFile of other Handler fails.
+func (h *Handler) FileSource(path string) (FileSource, error) {
+	size, err := h.Size()
+	if err != nil {
+		return FileSource{}, err
+	}
+
+	return FileSource{
+		Path:     path,
+		Size:     size,
+		Data:     h.writeZip,
+		volatile: h.volatile(),
+	}, nil
+}
+
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	size, err := h.Size()
+	if err != nil {
+		h.OnError(err)
+
+		return
+	}
+
+	formats := h.formats()
+
+	format, err := negotiateFormat(r, formats)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusNotAcceptable)
+
+		return
+	}
+
+	if len(formats) > 1 {
+		rw.Header().Set("Vary", "Accept")
+	}
+
+	rw.Header().Set("Content-Type", format.ContentType())
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.%s\"", h.archiveName, format))
+
+	switch format {
+	case FormatTar:
+		size, err := h.tarLength()
+		if err != nil {
 			h.OnError(err)
+			http.Error(rw, "failed to prepare archive", http.StatusInternalServerError)
 
 			return
 		}
 
-		h.closed = true
+		err = serveSized(rw, r, size, !h.volatile(), h.writeTar)
+	case FormatTarGz:
+		if r != nil && r.Method == http.MethodHead {
+			return
+		}
+
+		err = h.writeTarGz(rw)
+	default:
+		// Encryption headers are random, so that parts of different responses do not match.
+		err = serveSized(rw, r, size, !h.volatile(), h.writeZip)
+	}
+
+	if err != nil {
+		h.OnError(err)
+	}
+}
+
+// formats returns formats available for negotiation.
+func (h *Handler) formats() []Format {
+	// Tar has no encryption, so encrypted entries are only served in ZIP.
+	if h.encrypted() {
+		return []Format{FormatZip}
 	}
 
-	rw.Header().Set("Content-Type", "application/zip")
-	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.zip\"", h.archiveName))
-	rw.Header().Set("Content-Length", strconv.Itoa(int(h.totalBytes.written)))
+	if len(h.Formats) > 0 {
+		return h.Formats
+	}
+
+	return []Format{FormatZip, FormatTar, FormatTarGz}
+}
+
+// writeZip writes ZIP archive.
+func (h *Handler) writeZip(rw io.Writer) (err error) {
+	p := &writePass{}
+	defer p.close()
 
 	// Create a new zip archive.
 	w := zip.NewWriter(rw)
 	defer func() {
 		// Make sure to check the error on Close.
-		clErr := w.Close()
-		if clErr != nil {
-			h.OnError(clErr)
+		if clErr := w.Close(); clErr != nil && err == nil {
+			err = clErr
 		}
 	}()
 
-	var (
-		f   io.Writer
-		err error
-	)
-
 	for _, src := range h.sources {
-		if h.Streamable {
-			f, err = w.CreateRaw(&zip.FileHeader{
-				Name:               src.Path,
-				Method:             zip.Store,
-				Modified:           src.Modified,
-				CompressedSize64:   uint64(src.Size),
-				UncompressedSize64: uint64(src.Size),
-				CRC32:              src.CRC32,
-			})
-		} else {
-			f, err = w.CreateHeader(&zip.FileHeader{
-				Name:     src.Path,
-				Method:   zip.Store,
-				Modified: src.Modified,
-			})
-		}
+		src = p.source(src)
 
+		f, fh, err := h.createEntry(w, src)
 		if err != nil {
-			h.OnError(err)
-
-			return
+			return err
 		}
 
-		if err := src.Data(f); err != nil {
-			h.OnError(err)
-
-			return
+		if err := h.writeData(f, fh, src); err != nil {
+			return err
 		}
 	}
+
+	return nil
+}
+
+const (
+	zipVersion20 = 20 // 2.0
+	zipVersion51 = 51 // 5.1, AES encryption
+)
+
+// timeToMsDosTime converts a time.Time to an MS-DOS date and time.
+// The resolution is 2s.
+// See: https://learn.microsoft.com/en-us/windows/win32/api/winbase/nf-winbase-filetimetodosdatetime
+func timeToMsDosTime(t time.Time) (fDate uint16, fTime uint16) {
+	fDate = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	fTime = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+
+	return
 }
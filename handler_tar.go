@@ -0,0 +1,189 @@
+package httpzip
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// tarBlockSize is a size of tar record, entry data is padded to it.
+const tarBlockSize = 512
+
+// encrypted checks if any of entries is encrypted.
+func (h *Handler) encrypted() bool {
+	if h.Encryption != nil && h.Encryption.Password != "" {
+		return true
+	}
+
+	for _, src := range h.sources {
+		if src.Encryption != nil && src.Encryption.Password != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// volatile checks if archive differs between writes, because of encryption or nested encrypted archives.
+func (h *Handler) volatile() bool {
+	if h.encrypted() {
+		return true
+	}
+
+	for _, src := range h.sources {
+		if src.volatile {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tarLength returns size of tar archive, it is deterministic for given headers.
+func (h *Handler) tarLength() (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.tarSizeDone {
+		return h.tarSize, nil
+	}
+
+	total := &countingWriter{}
+
+	for _, src := range h.sources {
+		hdr, err := tarHeader(src)
+		if err != nil {
+			return 0, err
+		}
+
+		// Header may take several records with PAX extended attributes.
+		if err := tar.NewWriter(total).WriteHeader(hdr); err != nil {
+			return 0, err
+		}
+
+		total.written += (hdr.Size + tarBlockSize - 1) / tarBlockSize * tarBlockSize
+	}
+
+	// End of archive is marked with two empty records.
+	h.tarSize = total.written + 2*tarBlockSize
+	h.tarSizeDone = true
+
+	return h.tarSize, nil
+}
+
+// writeTar writes tar archive in PAX format.
+func (h *Handler) writeTar(w io.Writer) error {
+	p := &writePass{}
+	defer p.close()
+
+	tw := tar.NewWriter(w)
+
+	for _, src := range h.sources {
+		src = p.source(src)
+
+		hdr, err := tarHeader(src)
+		if err != nil {
+			return err
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if hdr.Typeflag == tar.TypeReg {
+			if err := src.writePlain(tw); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tw.Close()
+}
+
+func (h *Handler) writeTarGz(w io.Writer) error {
+	gw := gzip.NewWriter(w)
+
+	if err := h.writeTar(gw); err != nil {
+		return err
+	}
+
+	return gw.Close()
+}
+
+// tarHeader converts file source to tar header, data of symlink is read as its target.
+func tarHeader(src FileSource) (*tar.Header, error) {
+	hdr := &tar.Header{
+		Name:     src.Path,
+		Typeflag: tar.TypeReg,
+		Mode:     int64(src.Mode.Perm()),
+		Size:     src.Size,
+		ModTime:  src.Modified,
+		Format:   tar.FormatPAX,
+	}
+
+	switch {
+	case src.Mode.IsDir() || strings.HasSuffix(src.Path, "/"):
+		hdr.Typeflag = tar.TypeDir
+		hdr.Size = 0
+
+		if hdr.Mode == 0 {
+			hdr.Mode = 0o755
+		}
+	case src.Mode&fs.ModeSymlink != 0:
+		target := bytes.NewBuffer(nil)
+		if err := src.writePlain(target); err != nil {
+			return nil, err
+		}
+
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = target.String()
+		hdr.Size = 0
+
+		if hdr.Mode == 0 {
+			hdr.Mode = 0o777
+		}
+	case hdr.Mode == 0:
+		hdr.Mode = 0o644
+	}
+
+	return hdr, nil
+}
+
+// writePlain writes uncompressed contents, raw data is decompressed.
+func (fs *FileSource) writePlain(w io.Writer) error {
+	if !fs.Raw || fs.Method == zip.Store {
+		return fs.Data(w)
+	}
+
+	dcomp := decompressor(fs.Method)
+	if dcomp == nil {
+		return &UnsupportedMethodError{Entry: fs.Path, Method: fs.Method}
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+
+	go func() {
+		err := fs.Data(pw)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	rc := dcomp(pr)
+
+	_, err := io.Copy(w, rc)
+
+	// Unblocks Data if decompression has failed.
+	_ = pr.CloseWithError(err)
+	_ = rc.Close()
+
+	if dataErr := <-done; err == nil && dataErr != nil {
+		err = dataErr
+	}
+
+	return err
+}
@@ -0,0 +1,121 @@
+package httpzip_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+// zipEntry describes an entry of test archive.
+type zipEntry struct {
+	name    string
+	data    []byte
+	method  uint16
+	comment string
+	mode    fs.FileMode
+	extra   []byte
+
+	// raw writes sizes and CRC32 to local file header instead of data descriptor,
+	// only Store and Deflate methods are supported.
+	raw bool
+}
+
+// zipArchive creates archive with entries.
+func zipArchive(t *testing.T, entries ...zipEntry) []byte {
+	t.Helper()
+
+	return zipArchiveComment(t, "", entries...)
+}
+
+// zipArchiveComment creates archive with entries and archive comment.
+func zipArchiveComment(t *testing.T, comment string, entries ...zipEntry) []byte {
+	t.Helper()
+
+	buf := bytes.NewBuffer(nil)
+	w := zip.NewWriter(buf)
+
+	if err := w.SetComment(comment); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range entries {
+		fh := &zip.FileHeader{Name: e.name, Method: e.method, Comment: e.comment, Extra: e.extra}
+
+		if e.mode != 0 {
+			fh.SetMode(e.mode)
+		}
+
+		data := e.data
+
+		var (
+			f   io.Writer
+			err error
+		)
+
+		if e.raw {
+			fh.CRC32 = crc32.ChecksumIEEE(data)
+			fh.UncompressedSize64 = uint64(len(data))
+
+			switch e.method {
+			case zip.Store:
+			case zip.Deflate:
+				data = deflate(t, data)
+			default:
+				t.Fatalf("unsupported raw method %d", e.method)
+			}
+
+			fh.CompressedSize64 = uint64(len(data))
+
+			f, err = w.CreateRaw(fh)
+		} else {
+			// CreateHeader writes data descriptor, so sizes are only known after data is read.
+			f, err = w.CreateHeader(fh)
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Directories have no data.
+		if len(data) == 0 && strings.HasSuffix(e.name, "/") {
+			continue
+		}
+
+		if _, err := f.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// deflate compresses data with the best compression.
+func deflate(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	buf := bytes.NewBuffer(nil)
+
+	fw, err := flate.NewWriter(buf, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
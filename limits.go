@@ -0,0 +1,181 @@
+package httpzip
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Limits restricts resources consumed by StreamReader, zero values disable checks.
+type Limits struct {
+	// MaxEntries is a maximum number of entries in archive.
+	MaxEntries int
+
+	// MaxEntrySize is a maximum uncompressed size of an entry.
+	MaxEntrySize uint64
+
+	// MaxTotalSize is a maximum uncompressed size of all entries, including nested archives.
+	MaxTotalSize uint64
+
+	// MaxCompressionRatio is a maximum ratio of uncompressed to compressed size of an entry,
+	// it is checked once entry produced at least 64 KiB.
+	MaxCompressionRatio float64
+
+	// MaxNameLength is a maximum length of entry name in bytes.
+	MaxNameLength int
+
+	// MaxExtraLength is a maximum length of entry extra fields in bytes.
+	MaxExtraLength int
+
+	// MaxNestingDepth is a maximum depth of archives opened with Entry.OpenNested,
+	// top level archive has depth 0.
+	MaxNestingDepth int
+}
+
+// minRatioCheckSize avoids false positives on small entries of repetitive data.
+const minRatioCheckSize = 64 << 10
+
+// Limit errors, every one of them matches ErrLimitExceeded.
+var (
+	ErrLimitExceeded    = errors.New("limit exceeded")
+	ErrTooManyEntries   = fmt.Errorf("%w: too many entries", ErrLimitExceeded)
+	ErrEntryTooLarge    = fmt.Errorf("%w: entry too large", ErrLimitExceeded)
+	ErrTotalTooLarge    = fmt.Errorf("%w: total size too large", ErrLimitExceeded)
+	ErrCompressionRatio = fmt.Errorf("%w: compression ratio too high", ErrLimitExceeded)
+	ErrNameTooLong      = fmt.Errorf("%w: entry name too long", ErrLimitExceeded)
+	ErrExtraTooLong     = fmt.Errorf("%w: extra fields too long", ErrLimitExceeded)
+	ErrNestingTooDeep   = fmt.Errorf("%w: nesting too deep", ErrLimitExceeded)
+	ErrSpoolTooLarge    = fmt.Errorf("%w: spooled entry too large", ErrLimitExceeded)
+)
+
+// LimitError describes violated limit.
+type LimitError struct {
+	Err   error  // One of limit errors, e.g. ErrEntryTooLarge.
+	Entry string // Entry name, empty for archive-wide limits.
+	Value uint64 // Value that exceeded the limit.
+	Limit uint64
+}
+
+func (e *LimitError) Error() string {
+	if e.Entry == "" {
+		return fmt.Sprintf("%s: %d > %d", e.Err, e.Value, e.Limit)
+	}
+
+	return fmt.Sprintf("%s: %d > %d in %s", e.Err, e.Value, e.Limit, e.Entry)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// usage accumulates resource consumption shared by parent and nested readers.
+type usage struct {
+	total uint64
+}
+
+func (z *StreamReader) checkHeader(nameLen, extraLen int) error {
+	l := z.Limits
+
+	if l.MaxEntries > 0 && z.numEntries > l.MaxEntries {
+		return &LimitError{Err: ErrTooManyEntries, Value: uint64(z.numEntries), Limit: uint64(l.MaxEntries)}
+	}
+
+	if l.MaxNameLength > 0 && nameLen > l.MaxNameLength {
+		return &LimitError{Err: ErrNameTooLong, Value: uint64(nameLen), Limit: uint64(l.MaxNameLength)}
+	}
+
+	if l.MaxExtraLength > 0 && extraLen > l.MaxExtraLength {
+		return &LimitError{Err: ErrExtraTooLong, Value: uint64(extraLen), Limit: uint64(l.MaxExtraLength)}
+	}
+
+	return nil
+}
+
+// checkOpen validates declared size before decompression starts.
+func (e *Entry) checkOpen() error {
+	l := e.z.Limits
+
+	if l.MaxEntrySize > 0 && !e.unknownSize && e.UncompressedSize64 > l.MaxEntrySize {
+		return &LimitError{Err: ErrEntryTooLarge, Entry: e.Name, Value: e.UncompressedSize64, Limit: l.MaxEntrySize}
+	}
+
+	return nil
+}
+
+// checkRead validates sizes after n more bytes were decompressed.
+func (r *checksumReader) checkRead(n int) error {
+	e := r.entry
+	z := e.z
+	l := z.Limits
+
+	z.usage.total += uint64(n)
+
+	if l.MaxEntrySize > 0 && r.nread > l.MaxEntrySize {
+		return &LimitError{Err: ErrEntryTooLarge, Entry: e.Name, Value: r.nread, Limit: l.MaxEntrySize}
+	}
+
+	if l.MaxTotalSize > 0 && z.usage.total > l.MaxTotalSize {
+		return &LimitError{Err: ErrTotalTooLarge, Entry: e.Name, Value: z.usage.total, Limit: l.MaxTotalSize}
+	}
+
+	if l.MaxCompressionRatio > 0 && r.nread >= minRatioCheckSize {
+		compressed := uint64(max(z.r.n-e.dataOffset, 1))
+
+		if float64(r.nread)/float64(compressed) > l.MaxCompressionRatio {
+			return &LimitError{
+				Err:   ErrCompressionRatio,
+				Entry: e.Name,
+				Value: r.nread / compressed,
+				Limit: uint64(l.MaxCompressionRatio),
+			}
+		}
+	}
+
+	return nil
+}
+
+// OpenNested opens entry contents as a ZIP archive.
+//
+// Nested reader inherits Password, Limits and decompressors, uncompressed sizes
+// count towards Limits.MaxTotalSize of the parent.
+func (e *Entry) OpenNested() (*StreamReader, error) {
+	if err := e.checkNesting(); err != nil {
+		return nil, err
+	}
+
+	rc, err := e.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	return e.nestedReader(rc), nil
+}
+
+func (e *Entry) checkNesting() error {
+	l := e.z.Limits
+
+	if depth := e.z.depth + 1; l.MaxNestingDepth > 0 && depth > l.MaxNestingDepth {
+		return &LimitError{
+			Err:   ErrNestingTooDeep,
+			Entry: e.Name,
+			Value: uint64(depth),
+			Limit: uint64(l.MaxNestingDepth),
+		}
+	}
+
+	return nil
+}
+
+// nestedReader creates reader of entry contents that inherits settings of parent.
+func (e *Entry) nestedReader(r io.Reader) *StreamReader {
+	z := e.z
+
+	n := NewStreamReader(r)
+	n.Password = z.Password
+	n.Limits = z.Limits
+	n.decompressors = z.decompressors
+	n.depth = z.depth + 1
+	n.usage = z.usage
+
+	return n
+}
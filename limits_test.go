@@ -0,0 +1,129 @@
+package httpzip_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/vearutop/httpzip"
+)
+
+func zeroesArchive(t *testing.T, size int, names ...string) []byte {
+	t.Helper()
+
+	entries := make([]zipEntry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, zipEntry{name: name, data: make([]byte, size), method: zip.Deflate})
+	}
+
+	return zipArchive(t, entries...)
+}
+
+func TestStreamReader_Limits(t *testing.T) {
+	archive := zeroesArchive(t, 1<<20, "a.bin", "b.bin", "c.bin")
+
+	for _, tc := range []struct {
+		name   string
+		limits httpzip.Limits
+		err    error
+	}{
+		{name: "entries", limits: httpzip.Limits{MaxEntries: 2}, err: httpzip.ErrTooManyEntries},
+		{name: "entry size", limits: httpzip.Limits{MaxEntrySize: 1000}, err: httpzip.ErrEntryTooLarge},
+		{name: "total size", limits: httpzip.Limits{MaxTotalSize: 2 << 20}, err: httpzip.ErrTotalTooLarge},
+		{name: "ratio", limits: httpzip.Limits{MaxCompressionRatio: 100}, err: httpzip.ErrCompressionRatio},
+		{name: "name", limits: httpzip.Limits{MaxNameLength: 4}, err: httpzip.ErrNameTooLong},
+		{name: "no violation", limits: httpzip.Limits{MaxEntries: 3, MaxTotalSize: 3 << 20, MaxCompressionRatio: 2000}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sr := httpzip.NewStreamReader(bytes.NewReader(archive))
+			sr.Limits = tc.limits
+
+			_, err := readAll(sr)
+
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("%v expected, got %v", tc.err, err)
+			}
+
+			var le *httpzip.LimitError
+			if tc.err != nil && (!errors.As(err, &le) || !errors.Is(err, httpzip.ErrLimitExceeded)) {
+				t.Fatalf("limit error expected, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStreamReader_Limits_duringDecompression(t *testing.T) {
+	sr := httpzip.NewStreamReader(bytes.NewReader(zeroesArchive(t, 10<<20, "bomb.bin")))
+	sr.Limits.MaxEntrySize = 1 << 20
+
+	e, err := sr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := e.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := io.Copy(io.Discard, rc)
+	if !errors.Is(err, httpzip.ErrEntryTooLarge) {
+		t.Fatalf("entry too large expected, got %v", err)
+	}
+
+	// Decompression stops shortly after the limit.
+	if n > 2<<20 {
+		t.Fatalf("too many bytes decompressed: %d", n)
+	}
+}
+
+func TestEntry_OpenNested(t *testing.T) {
+	archive := zipArchive(t, zipEntry{name: "l1.zip", data: zipArchive(t, zipEntry{name: "l2.zip", data: zeroesArchive(t, 100, "inner.txt"), method: zip.Deflate}), method: zip.Deflate})
+
+	sr := httpzip.NewStreamReader(bytes.NewReader(archive))
+	sr.Limits.MaxNestingDepth = 1
+
+	e, err := sr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l1, err := e.OpenNested()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err = l1.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Name != "l2.zip" {
+		t.Fatalf("unexpected nested entry: %s", e.Name)
+	}
+
+	if _, err := e.OpenNested(); !errors.Is(err, httpzip.ErrNestingTooDeep) {
+		t.Fatalf("nesting too deep expected, got %v", err)
+	}
+
+	sr = httpzip.NewStreamReader(bytes.NewReader(archive))
+
+	for _, name := range []string{"l1.zip", "l2.zip", "inner.txt"} {
+		e, err := sr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if e.Name != name {
+			t.Fatalf("%s expected, got %s", name, e.Name)
+		}
+
+		if name != "inner.txt" {
+			if sr, err = e.OpenNested(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package httpzip
+
+import (
+	"io/fs"
+	"time"
+)
+
+// InfoZipNewUnixExtraID is an Info-ZIP Unix extra field with variable size UID and GID.
+const InfoZipNewUnixExtraID = 0x7875
+
+// TimeKind identifies meaning of a timestamp.
+type TimeKind string
+
+// Timestamp kinds.
+const (
+	TimeModified = TimeKind("modified")
+	TimeAccessed = TimeKind("accessed")
+	TimeCreated  = TimeKind("created")
+)
+
+// Timestamp is a time value with the header field it was read from.
+type Timestamp struct {
+	Kind   TimeKind
+	Source TimeSource
+	Time   time.Time
+}
+
+// UnixOwner is a numeric owner of a file.
+type UnixOwner struct {
+	UID    uint32
+	GID    uint32
+	Source uint16 // Extra field ID.
+}
+
+// Zip64Fields are values of Zip64 extended information extra field of local header.
+type Zip64Fields struct {
+	UncompressedSize uint64
+	CompressedSize   uint64
+	HeaderOffset     uint64
+	DiskNumber       uint32
+	Count            int // Number of values present in the field, in the order of struct fields.
+}
+
+// ExtraField is a raw extra field.
+type ExtraField struct {
+	ID   uint16
+	Data []byte
+}
+
+// Metadata is a structured view of entry header and extra fields.
+type Metadata struct {
+	// Times lists all timestamps of local header and extra fields in order of appearance.
+	Times []Timestamp
+
+	// Owner is the last Unix owner found in extra fields.
+	Owner *UnixOwner
+
+	// Mode is a file mode from central directory, it is zero if central directory is not available.
+	Mode fs.FileMode
+
+	Zip64 *Zip64Fields
+
+	// Unknown lists extra fields that are not parsed.
+	Unknown []ExtraField
+}
+
+// Time returns the last timestamp of given kind, it prefers extra fields over MS-DOS time.
+func (m Metadata) Time(kind TimeKind) (Timestamp, bool) {
+	for i := len(m.Times) - 1; i >= 0; i-- {
+		if m.Times[i].Kind == kind {
+			return m.Times[i], true
+		}
+	}
+
+	return Timestamp{}, false
+}
+
+// Metadata parses local header extra fields.
+func (e *Entry) Metadata() Metadata {
+	var m Metadata
+
+	if e.ModifiedTime != 0 || e.ModifiedDate != 0 {
+		m.Times = append(m.Times, Timestamp{
+			Kind:   TimeModified,
+			Source: TimeSourceDOS,
+			Time:   msDosTimeToTime(e.ModifiedDate, e.ModifiedTime),
+		})
+	}
+
+	if e.ExternalAttrs != 0 {
+		m.Mode = e.Mode()
+	}
+
+	unixTime := func(kind TimeKind, source TimeSource, ts uint32) {
+		m.Times = append(m.Times, Timestamp{Kind: kind, Source: source, Time: time.Unix(int64(ts), 0).UTC()})
+	}
+
+	for extra := readBuf(e.Extra); len(extra) >= 4; {
+		id := extra.uint16()
+		size := int(extra.uint16())
+
+		if len(extra) < size {
+			break
+		}
+
+		b := extra.sub(size)
+
+		switch id {
+		case Zip64ExtraID:
+			z := &Zip64Fields{}
+
+			for _, v := range []*uint64{&z.UncompressedSize, &z.CompressedSize, &z.HeaderOffset} {
+				if len(b) >= 8 {
+					*v = b.uint64()
+					z.Count++
+				}
+			}
+
+			if len(b) >= 4 {
+				z.DiskNumber = b.uint32()
+				z.Count++
+			}
+
+			m.Zip64 = z
+		case NtfsExtraID:
+			m.Times = append(m.Times, ntfsTimes(b)...)
+		case UnixExtraID, InfoZipUnixExtraID:
+			if len(b) < 8 {
+				continue
+			}
+
+			unixTime(TimeAccessed, TimeSourceUnix, b.uint32())
+			unixTime(TimeModified, TimeSourceUnix, b.uint32())
+
+			if len(b) >= 4 {
+				m.Owner = &UnixOwner{UID: uint32(b.uint16()), GID: uint32(b.uint16()), Source: id}
+			}
+		case ExtTimeExtraID:
+			if len(b) < 1 {
+				continue
+			}
+
+			flags := b.uint8()
+
+			// Central directory has only modification time, but flags can indicate other times.
+			for i, kind := range []TimeKind{TimeModified, TimeAccessed, TimeCreated} {
+				if flags&(1<<i) != 0 && len(b) >= 4 {
+					unixTime(kind, TimeSourceExtTime, b.uint32())
+				}
+			}
+		case InfoZipNewUnixExtraID:
+			if owner := newUnixOwner(b); owner != nil {
+				m.Owner = owner
+			}
+		case AESExtraID, UnicodePathExtraID, UnicodeCommentExtraID:
+		default:
+			m.Unknown = append(m.Unknown, ExtraField{ID: id, Data: b})
+		}
+	}
+
+	return m
+}
+
+func ntfsTimes(b readBuf) []Timestamp {
+	var times []Timestamp
+
+	if len(b) < 4 {
+		return nil
+	}
+
+	b.uint32() // Reserved.
+
+	for len(b) >= 4 {
+		tag := b.uint16()
+		size := int(b.uint16())
+
+		if len(b) < size {
+			break
+		}
+
+		attr := b.sub(size)
+		if tag != 1 || size != 24 {
+			continue
+		}
+
+		for _, kind := range []TimeKind{TimeModified, TimeAccessed, TimeCreated} {
+			times = append(times, Timestamp{Kind: kind, Source: TimeSourceNTFS, Time: ntfsTime(attr.uint64())})
+		}
+	}
+
+	return times
+}
+
+// ntfsTime converts number of 100ns intervals since 1601.
+func ntfsTime(ts uint64) time.Time {
+	const ticksPerSecond = 1e7
+
+	epoch := time.Date(1601, time.January, 1, 0, 0, 0, 0, time.UTC)
+	secs := int64(ts / ticksPerSecond)
+	nsecs := int64(ts%ticksPerSecond) * (1e9 / ticksPerSecond)
+
+	return time.Unix(epoch.Unix()+secs, nsecs).UTC()
+}
+
+// newUnixOwner parses Info-ZIP new Unix extra field: version, UID size, UID, GID size, GID.
+func newUnixOwner(b readBuf) *UnixOwner {
+	if len(b) < 2 || b.uint8() != 1 {
+		return nil
+	}
+
+	uid, ok := varUint(&b)
+	if !ok {
+		return nil
+	}
+
+	gid, ok := varUint(&b)
+	if !ok {
+		return nil
+	}
+
+	return &UnixOwner{UID: uid, GID: gid, Source: InfoZipNewUnixExtraID}
+}
+
+// varUint reads size-prefixed little-endian unsigned integer.
+func varUint(b *readBuf) (uint32, bool) {
+	if len(*b) < 1 {
+		return 0, false
+	}
+
+	size := int(b.uint8())
+	if size > 4 || len(*b) < size {
+		return 0, false
+	}
+
+	var v uint32
+
+	for i, c := range b.sub(size) {
+		v |= uint32(c) << (8 * i)
+	}
+
+	return v, true
+}
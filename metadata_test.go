@@ -0,0 +1,119 @@
+package httpzip_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/vearutop/httpzip"
+)
+
+func extraField(id uint16, data ...any) []byte {
+	buf := bytes.NewBuffer(nil)
+
+	for _, v := range data {
+		_ = binary.Write(buf, binary.LittleEndian, v)
+	}
+
+	field := binary.LittleEndian.AppendUint16(nil, id)
+	field = binary.LittleEndian.AppendUint16(field, uint16(buf.Len()))
+
+	return append(field, buf.Bytes()...)
+}
+
+func TestEntry_Metadata(t *testing.T) {
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	atime := mtime.Add(time.Hour)
+	ctime := mtime.Add(-time.Hour)
+	ntfs := func(t time.Time) uint64 {
+		return uint64(t.Unix()-time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC).Unix()) * 1e7
+	}
+
+	var extra []byte
+	extra = append(extra, extraField(httpzip.ExtTimeExtraID,
+		uint8(7), uint32(mtime.Unix()), uint32(atime.Unix()), uint32(ctime.Unix()))...)
+	extra = append(extra, extraField(httpzip.NtfsExtraID,
+		uint32(0), uint16(1), uint16(24), ntfs(mtime), ntfs(atime), ntfs(ctime))...)
+	extra = append(extra, extraField(httpzip.InfoZipNewUnixExtraID,
+		uint8(1), uint8(4), uint32(1000), uint8(2), uint16(100))...)
+	extra = append(extra, extraField(0xcafe, []byte("raw"))...)
+
+	buf := bytes.NewBuffer(nil)
+	w := zip.NewWriter(buf)
+
+	fh := &zip.FileHeader{Name: "a.txt", Extra: extra}
+	fh.SetModTime(mtime)
+
+	if _, err := w.CreateRaw(fh); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := httpzip.NewStreamReader(bytes.NewReader(buf.Bytes())).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md := e.Metadata()
+
+	if len(md.Times) != 7 {
+		t.Fatalf("unexpected timestamps: %v", md.Times)
+	}
+
+	for _, tc := range []struct {
+		kind   httpzip.TimeKind
+		time   time.Time
+		source httpzip.TimeSource
+	}{
+		{kind: httpzip.TimeModified, time: mtime, source: httpzip.TimeSourceNTFS},
+		{kind: httpzip.TimeAccessed, time: atime, source: httpzip.TimeSourceNTFS},
+		{kind: httpzip.TimeCreated, time: ctime, source: httpzip.TimeSourceNTFS},
+	} {
+		ts, ok := md.Time(tc.kind)
+		if !ok || !ts.Time.Equal(tc.time) || ts.Source != tc.source {
+			t.Fatalf("unexpected %s time: %+v", tc.kind, ts)
+		}
+	}
+
+	if md.Times[0].Source != httpzip.TimeSourceDOS || md.Times[3].Kind != httpzip.TimeCreated ||
+		!md.Times[3].Time.Equal(ctime) || md.Times[3].Source != httpzip.TimeSourceExtTime {
+		t.Fatalf("unexpected timestamps: %v", md.Times)
+	}
+
+	if md.Owner == nil || md.Owner.UID != 1000 || md.Owner.GID != 100 {
+		t.Fatalf("unexpected owner: %+v", md.Owner)
+	}
+
+	if len(md.Unknown) != 1 || md.Unknown[0].ID != 0xcafe || string(md.Unknown[0].Data) != "raw" {
+		t.Fatalf("unexpected unknown fields: %+v", md.Unknown)
+	}
+
+	if md.Zip64 != nil {
+		t.Fatalf("unexpected zip64 fields: %+v", md.Zip64)
+	}
+}
+
+func TestEntry_Modified_ntfs(t *testing.T) {
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 123456700, time.UTC)
+	ticks := uint64(mtime.Unix()-time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC).Unix())*1e7 + uint64(mtime.Nanosecond()/100)
+
+	archive := zipArchive(t, zipEntry{
+		name:  "a.txt",
+		extra: extraField(httpzip.NtfsExtraID, uint32(0), uint16(1), uint16(24), ticks, ticks, ticks),
+	})
+
+	e, err := httpzip.NewStreamReader(bytes.NewReader(archive)).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts, ok := e.Metadata().Time(httpzip.TimeModified)
+	if !ok || !ts.Time.Equal(mtime) || !e.Modified.Equal(ts.Time) || e.ModifiedSource != httpzip.TimeSourceNTFS {
+		t.Fatalf("unexpected modification time: %v (%s), %+v", e.Modified, e.ModifiedSource, ts)
+	}
+}
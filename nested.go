@@ -0,0 +1,196 @@
+package httpzip
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// NestedSeparator separates archive name and entry name in composite path of nested entry.
+const NestedSeparator = "!/"
+
+// DefaultNestedExtensions are extensions of entries that are checked to be nested ZIP archives.
+var DefaultNestedExtensions = []string{".zip", ".jar", ".war", ".ear", ".apk", ".aar", ".nupkg", ".whl"}
+
+// NestedOptions configures traversal of nested archives.
+type NestedOptions struct {
+	// Prefix is prepended to composite paths, for example "outer.zip!/".
+	Prefix string
+
+	// Extensions of entries that are checked to be nested archives, DefaultNestedExtensions is used if empty.
+	Extensions []string
+
+	// DetectMagic checks every file entry to be nested archive regardless of extension.
+	DetectMagic bool
+
+	// MaxDepth limits descending into nested archives, archives at MaxDepth are reported as regular entries.
+	// Zero value does not limit descending, but Limits.MaxNestingDepth still applies.
+	MaxDepth int
+}
+
+// NestedEntry is an entry of archive or nested archive.
+type NestedEntry struct {
+	*Entry
+
+	// Path is a composite path, for example "lib/a.jar!/META-INF/MANIFEST.MF".
+	Path string
+
+	// Depth is 0 for entries of top level archive.
+	Depth int
+
+	// Archive indicates that entry is a ZIP archive, its entries follow unless it is opened.
+	Archive bool
+
+	peeked io.ReadCloser
+	opened bool
+}
+
+// Open returns entry data, it is only valid until the next entry.
+// Opening an archive entry prevents descending into it.
+func (n *NestedEntry) Open() (io.ReadCloser, error) {
+	if n.opened {
+		return nil, ErrEntryOpened
+	}
+
+	n.opened = true
+
+	if n.peeked != nil {
+		return n.peeked, nil
+	}
+
+	return n.Entry.Open()
+}
+
+// WalkNested calls fn for every remaining entry, descending into entries that are ZIP archives.
+//
+// Nested archives are detected by magic bytes, only entries with matching extension are checked unless
+// NestedOptions.DetectMagic is set. Archive entry is passed to fn before its entries, fn can return
+// fs.SkipDir to skip them. Traversal is a single forward pass, nested archives are decompressed on the fly.
+// Walk stops early without error if fn returns fs.SkipAll, other errors of fn are returned.
+func (z *StreamReader) WalkNested(opts NestedOptions, fn func(e *NestedEntry) error) error {
+	if len(opts.Extensions) == 0 {
+		opts.Extensions = DefaultNestedExtensions
+	}
+
+	err := z.walkNested(opts, opts.Prefix, 0, fn)
+	if errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+
+	return err
+}
+
+func (z *StreamReader) walkNested(opts NestedOptions, prefix string, depth int, fn func(e *NestedEntry) error) error {
+	wrap := func(err error) error {
+		if depth > 0 {
+			err = fmt.Errorf("%s: %w", strings.TrimSuffix(prefix, NestedSeparator), err)
+		}
+
+		return err
+	}
+
+	for e, err := range z.All() {
+		if err != nil {
+			return wrap(err)
+		}
+
+		ne := &NestedEntry{Entry: e, Path: prefix + e.Name, Depth: depth}
+
+		if !e.IsDir() && (opts.MaxDepth == 0 || depth < opts.MaxDepth) &&
+			(opts.DetectMagic || slices.Contains(opts.Extensions, strings.ToLower(path.Ext(e.Name)))) {
+			if err := ne.peek(); err != nil {
+				return err
+			}
+		}
+
+		if err := fn(ne); err != nil {
+			if ne.Archive && errors.Is(err, fs.SkipDir) {
+				if err := ne.release(); err != nil {
+					return wrap(err)
+				}
+
+				continue
+			}
+
+			ne.close()
+
+			return err
+		}
+
+		if !ne.Archive || ne.opened {
+			if err := ne.release(); err != nil {
+				return wrap(err)
+			}
+
+			continue
+		}
+
+		if err := e.checkNesting(); err != nil {
+			return err
+		}
+
+		err := e.nestedReader(ne.peeked).walkNested(opts, ne.Path+NestedSeparator, depth+1, fn)
+		if err != nil {
+			ne.close()
+
+			return err
+		}
+
+		if err := ne.release(); err != nil {
+			return wrap(err)
+		}
+	}
+
+	return nil
+}
+
+// release skips the rest of entry data before peeked data is closed, so that decompressor is not used after close.
+func (n *NestedEntry) release() error {
+	if n.peeked == nil || n.opened {
+		return nil
+	}
+
+	err := n.Entry.skip()
+	n.close()
+
+	return err
+}
+
+// close releases peeked data unless it was returned by Open.
+func (n *NestedEntry) close() {
+	if n.peeked != nil && !n.opened {
+		_ = n.peeked.Close()
+	}
+}
+
+// peek checks if entry data starts with ZIP signature.
+func (n *NestedEntry) peek() error {
+	rc, err := n.Entry.Open()
+	if errors.Is(err, ErrEncrypted) || errors.Is(err, ErrUnsupportedMethod) {
+		// Entry is reported as is, and fails when it is opened.
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(rc)
+
+	// Short or broken data is reported when entry is read.
+	magic, _ := br.Peek(4)
+
+	n.Archive = bytes.Equal(magic, []byte("PK\x03\x04")) || bytes.Equal(magic, []byte("PK\x05\x06"))
+	n.peeked = struct {
+		io.Reader
+		io.Closer
+	}{br, rc}
+
+	return nil
+}
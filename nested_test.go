@@ -0,0 +1,335 @@
+package httpzip_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/vearutop/httpzip"
+)
+
+func TestStreamReader_WalkNested(t *testing.T) {
+	inner := zipArchive(t, zipEntry{name: "deep.txt", data: []byte("deep")})
+	jar := zipArchive(t,
+		zipEntry{name: "META-INF/MANIFEST.MF", data: []byte("Manifest-Version: 1.0"), method: zip.Deflate},
+		zipEntry{name: "inner.zip", data: inner},
+	)
+	archive := zipArchive(t,
+		zipEntry{name: "readme.txt", data: []byte("readme")},
+		zipEntry{name: "lib/a.jar", data: jar, method: zip.Deflate},
+		zipEntry{name: "data.bin", data: inner},
+		zipEntry{name: "fake.zip", data: []byte("not a zip")},
+	)
+
+	walk := func(opts httpzip.NestedOptions, skip string) ([]string, map[string]string) {
+		var paths []string
+
+		contents := map[string]string{}
+
+		err := httpzip.NewStreamReader(bytes.NewReader(archive)).WalkNested(opts, func(e *httpzip.NestedEntry) error {
+			p := e.Path
+			if e.Archive {
+				p += " (archive)"
+			}
+
+			paths = append(paths, p)
+
+			if e.Path == skip {
+				return fs.SkipDir
+			}
+
+			if !e.Archive {
+				rc, err := e.Open()
+				if err != nil {
+					return err
+				}
+
+				c, err := io.ReadAll(rc)
+				if err != nil {
+					return err
+				}
+
+				contents[e.Path] = string(c)
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return paths, contents
+	}
+
+	paths, contents := walk(httpzip.NestedOptions{Prefix: "outer.zip!/"}, "")
+
+	if !slices.Equal(paths, []string{
+		"outer.zip!/readme.txt",
+		"outer.zip!/lib/a.jar (archive)",
+		"outer.zip!/lib/a.jar!/META-INF/MANIFEST.MF",
+		"outer.zip!/lib/a.jar!/inner.zip (archive)",
+		"outer.zip!/lib/a.jar!/inner.zip!/deep.txt",
+		"outer.zip!/data.bin",
+		"outer.zip!/fake.zip",
+	}) {
+		t.Fatalf("unexpected paths: %v", paths)
+	}
+
+	if contents["outer.zip!/lib/a.jar!/inner.zip!/deep.txt"] != "deep" || contents["outer.zip!/fake.zip"] != "not a zip" ||
+		contents["outer.zip!/data.bin"] != string(inner) {
+		t.Fatalf("unexpected contents: %v", contents)
+	}
+
+	paths, _ = walk(httpzip.NestedOptions{DetectMagic: true, MaxDepth: 1}, "data.bin")
+
+	if !slices.Equal(paths, []string{
+		"readme.txt",
+		"lib/a.jar (archive)",
+		"lib/a.jar!/META-INF/MANIFEST.MF",
+		"lib/a.jar!/inner.zip",
+		"data.bin (archive)",
+		"fake.zip",
+	}) {
+		t.Fatalf("unexpected paths: %v", paths)
+	}
+
+	// Limits of reader apply to nested archives.
+	sr := httpzip.NewStreamReader(bytes.NewReader(archive))
+	sr.Limits.MaxNestingDepth = 1
+
+	err := sr.WalkNested(httpzip.NestedOptions{}, func(*httpzip.NestedEntry) error { return nil })
+	if !errors.Is(err, httpzip.ErrNestingTooDeep) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// closedReader fails reads after it is closed, like decompressors that are returned to a pool.
+type closedReader struct {
+	r      io.Reader
+	closed *int
+	done   bool
+}
+
+func (c *closedReader) Read(p []byte) (int, error) {
+	if c.done {
+		return 0, errors.New("read after close")
+	}
+
+	return c.r.Read(p)
+}
+
+func (c *closedReader) Close() error {
+	c.done = true
+	*c.closed++
+
+	return nil
+}
+
+func TestStreamReader_WalkNested_close(t *testing.T) {
+	// Nested data is larger than peeked buffer, so that it is not decompressed to the end while peeking.
+	inner := zipArchive(t, zipEntry{name: "deep.txt", data: bytes.Repeat([]byte("deep"), 10000)})
+	archive := zipArchive(t,
+		zipEntry{name: "skipped.zip", data: inner, method: zip.Deflate},
+		zipEntry{name: "plain.zip", data: []byte("not a zip"), method: zip.Deflate},
+		zipEntry{name: "opened.zip", data: inner, method: zip.Deflate, raw: true},
+		zipEntry{name: "nested.zip", data: inner, method: zip.Deflate},
+		zipEntry{name: "last.txt", data: []byte("last"), method: zip.Deflate, raw: true},
+	)
+
+	for _, strict := range []bool{false, true} {
+		opened, closed := 0, 0
+
+		sr := httpzip.NewStreamReader(bytes.NewReader(archive))
+		sr.StrictChecksum = strict
+		sr.RegisterDecompressor(zip.Deflate, func(r io.Reader) io.ReadCloser {
+			opened++
+
+			return &closedReader{r: flate.NewReader(r), closed: &closed}
+		})
+
+		var paths []string
+
+		if err := sr.WalkNested(httpzip.NestedOptions{}, func(e *httpzip.NestedEntry) error {
+			paths = append(paths, e.Path)
+
+			switch e.Path {
+			case "skipped.zip":
+				return fs.SkipDir
+			case "opened.zip":
+				// Data is closed before it is read to the end.
+				rc, err := e.Open()
+				if err != nil {
+					return err
+				}
+
+				return rc.Close()
+			}
+
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(paths, []string{"skipped.zip", "plain.zip", "opened.zip", "nested.zip", "nested.zip!/deep.txt", "last.txt"}) {
+			t.Fatalf("unexpected paths: %v", paths)
+		}
+
+		// Peeked data is released for skipped archives and entries that were not opened,
+		// last entry of known size is only decompressed in strict mode.
+		expected := 4
+		if strict {
+			expected++
+		}
+
+		if opened != expected || closed != expected {
+			t.Fatalf("unexpected number of opened and closed readers: %d, %d", opened, closed)
+		}
+	}
+}
+
+func TestHandler_FileSource(t *testing.T) {
+	for _, streamable := range []bool{false, true} {
+		outer := httpzip.NewHandler("bundle")
+		outer.Streamable = streamable
+
+		for _, name := range []string{"customer-a", "customer-b"} {
+			inner := httpzip.NewHandler(name)
+			inner.Streamable = !streamable
+
+			if err := inner.AddFile(httpzip.FileSource{
+				Path: "report.txt",
+				Size: int64(len(name)),
+				Data: func(w io.Writer) error {
+					_, err := w.Write([]byte(name))
+
+					return err
+				},
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			src, err := inner.FileSource(name + ".zip")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := outer.AddFile(src); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		rw := httptest.NewRecorder()
+		outer.ServeHTTP(rw, nil)
+
+		if rw.Header().Get("Content-Length") != strconv.Itoa(rw.Body.Len()) {
+			t.Fatalf("unexpected Content-Length: %s, %d", rw.Header().Get("Content-Length"), rw.Body.Len())
+		}
+
+		sr := httpzip.NewStreamReader(bytes.NewReader(rw.Body.Bytes()))
+		sr.StrictChecksum = true
+
+		contents := map[string]string{}
+
+		if err := sr.WalkNested(httpzip.NestedOptions{}, func(e *httpzip.NestedEntry) error {
+			if e.Archive {
+				return nil
+			}
+
+			rc, err := e.Open()
+			if err != nil {
+				return err
+			}
+
+			c, err := io.ReadAll(rc)
+			contents[e.Path] = string(c)
+
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(contents) != 2 || contents["customer-a.zip!/report.txt"] != "customer-a" ||
+			contents["customer-b.zip!/report.txt"] != "customer-b" {
+			t.Fatalf("unexpected contents: %v", contents)
+		}
+	}
+}
+
+func TestHandler_FileSource_encrypted(t *testing.T) {
+	inner := httpzip.NewHandler("secret")
+	inner.Encryption = &httpzip.Encryption{Password: "secret"}
+
+	if err := inner.AddFile(httpzip.FileSource{
+		Path: "report.txt",
+		Size: 5,
+		Data: func(w io.Writer) error {
+			_, err := w.Write([]byte("hello"))
+
+			return err
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := inner.FileSource("secret.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Encrypted archive differs between writes, so that its CRC32 can not be calculated in advance.
+	for _, enc := range []*httpzip.Encryption{nil, {Password: "outer", Method: httpzip.ZipCrypto}} {
+		outer := httpzip.NewHandler("bundle")
+		outer.Streamable = true
+		outer.Encryption = enc
+
+		if err := outer.AddFile(src); err == nil {
+			t.Fatal("error expected")
+		}
+	}
+
+	// CRC32 of data descriptor is calculated while serving.
+	outer := httpzip.NewHandler("bundle")
+	outer.OnError = func(err error) {
+		t.Fatal(err)
+	}
+
+	if err := outer.AddFile(src); err != nil {
+		t.Fatal(err)
+	}
+
+	rw := httptest.NewRecorder()
+	outer.ServeHTTP(rw, nil)
+
+	sr := httpzip.NewStreamReader(bytes.NewReader(rw.Body.Bytes()))
+	sr.StrictChecksum = true
+
+	if _, err := sr.Next(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sr.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Ranges of different responses do not match.
+	for _, url := range []string{"/bundle.zip", "/bundle.tar"} {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Range", "bytes=0-9")
+
+		rw := httptest.NewRecorder()
+		outer.ServeHTTP(rw, req)
+
+		if rw.Code != http.StatusOK || rw.Header().Get("Accept-Ranges") != "" ||
+			rw.Header().Get("Content-Length") != strconv.Itoa(rw.Body.Len()) {
+			t.Fatalf("unexpected response to %s: %d %v", url, rw.Code, rw.Header())
+		}
+	}
+}
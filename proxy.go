@@ -0,0 +1,363 @@
+package httpzip
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Proxy serves selected entries of upstream ZIP archive as a new archive without downloading it first.
+//
+// Entry data is copied raw, without decompression and recompression. Entries of unknown size
+// are decompressed in background to find the end of data, see Entry.OpenRaw.
+// Local file headers are copied with extra fields, file comments and attributes are not available
+// while streaming, because they are stored in upstream central directory.
+type Proxy struct {
+	archiveName string
+
+	// Open returns upstream archive stream for a request.
+	Open func(r *http.Request) (io.ReadCloser, error)
+
+	// Setup is called for every upstream StreamReader, for example to set Password, Limits or decompressors.
+	Setup func(sr *StreamReader)
+
+	// Select chooses entries to serve, all entries are served by default.
+	Select WalkOptions
+
+	// Rename returns entry name in served archive, entry is skipped if name is empty.
+	Rename func(e *Entry) string
+
+	// Streamable enables archive with sizes and CRC32 in local file headers and Content-Length.
+	//
+	// Upstream is read twice: first to collect local file headers, and then to copy data.
+	// Data is skipped in the first pass by seeking if upstream implements io.Seeker.
+	// If any of selected entries is encrypted or does not have sizes and CRC32 in local file header,
+	// archive is served as if Streamable was disabled.
+	Streamable bool
+
+	// Tar enables serving of tar archive instead of ZIP, see StreamReader.WriteTar.
+	// Select and Rename of Proxy are used instead of those of TarOptions.
+	Tar *TarOptions
+
+	OnError func(err error)
+}
+
+// NewProxy creates an instance of Proxy.
+func NewProxy(archiveName string, open func(r *http.Request) (io.ReadCloser, error)) *Proxy {
+	p := &Proxy{}
+	p.archiveName = archiveName
+	p.Open = open
+
+	p.OnError = func(err error) {
+		println("proxy zip: ", err.Error())
+	}
+
+	return p
+}
+
+// errNotStreamable stops collecting of headers for a streamable archive.
+var errNotStreamable = errors.New("entry is not streamable")
+
+func (p *Proxy) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if p.Tar != nil {
+		p.serveTar(rw, r)
+
+		return
+	}
+
+	if p.Streamable {
+		h, upstream, err := p.handler(r)
+		if err != nil {
+			p.OnError(err)
+			http.Error(rw, "failed to read upstream archive", http.StatusBadGateway)
+
+			return
+		}
+
+		if h != nil {
+			defer upstream.close()
+
+			h.ServeHTTP(rw, r)
+
+			return
+		}
+	}
+
+	up, err := p.Open(r)
+	if err != nil {
+		p.OnError(err)
+		http.Error(rw, "failed to open upstream archive", http.StatusBadGateway)
+
+		return
+	}
+
+	defer func() {
+		if err := up.Close(); err != nil {
+			p.OnError(err)
+		}
+	}()
+
+	rw.Header().Set("Content-Type", "application/zip")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.zip\"", p.archiveName))
+
+	w := zip.NewWriter(rw)
+
+	if err := p.reader(up).Walk(p.Select, func(e *Entry) error {
+		name := p.name(e)
+		if name == "" {
+			return nil
+		}
+
+		return copyEntry(w, e, name)
+	}); err != nil {
+		// Central directory is not written, so that client can not mistake broken archive for a complete one.
+		p.OnError(err)
+
+		return
+	}
+
+	if err := w.Close(); err != nil {
+		p.OnError(err)
+	}
+}
+
+func (p *Proxy) serveTar(rw http.ResponseWriter, r *http.Request) {
+	up, err := p.Open(r)
+	if err != nil {
+		p.OnError(err)
+		http.Error(rw, "failed to open upstream archive", http.StatusBadGateway)
+
+		return
+	}
+
+	defer func() {
+		if err := up.Close(); err != nil {
+			p.OnError(err)
+		}
+	}()
+
+	rw.Header().Set("Content-Type", "application/x-tar")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.tar\"", p.archiveName))
+
+	opts := *p.Tar
+	opts.Select = p.Select
+	opts.Rename = p.Rename
+
+	if err := p.reader(up).WriteTar(rw, opts); err != nil {
+		p.OnError(err)
+	}
+}
+
+func (p *Proxy) reader(r io.Reader) *StreamReader {
+	sr := NewStreamReader(r)
+
+	if p.Setup != nil {
+		p.Setup(sr)
+	}
+
+	return sr
+}
+
+func (p *Proxy) name(e *Entry) string {
+	if p.Rename == nil {
+		return e.Name
+	}
+
+	return p.Rename(e)
+}
+
+// handler collects local file headers of upstream into Handler with raw file sources,
+// it returns nil Handler if any of selected entries is not streamable.
+func (p *Proxy) handler(r *http.Request) (*Handler, *proxyUpstream, error) {
+	up, err := p.Open(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer func() {
+		if err := up.Close(); err != nil {
+			p.OnError(err)
+		}
+	}()
+
+	h := NewHandler(p.archiveName)
+	h.Streamable = true
+	h.OnError = p.OnError
+	h.Formats = []Format{FormatZip}
+
+	upstream := &proxyUpstream{p: p, r: r}
+
+	err = p.reader(up).Walk(p.Select, func(e *Entry) error {
+		name := p.name(e)
+		if name == "" {
+			return nil
+		}
+
+		if e.unknownSize || e.Flags&1 != 0 || (e.CRC32 == 0 && e.UncompressedSize64 > 0) {
+			return errNotStreamable
+		}
+
+		offset := e.HeaderOffset()
+
+		return h.AddFile(FileSource{
+			Path:           name,
+			Modified:       e.Modified,
+			Size:           int64(e.UncompressedSize64),
+			CRC32:          e.CRC32,
+			Comment:        e.Comment,
+			Extra:          copyExtra(e.Extra),
+			Raw:            true,
+			Method:         e.Method,
+			CompressedSize: int64(e.CompressedSize64),
+			Data: func(w io.Writer) error {
+				return upstream.copy(offset, w)
+			},
+		})
+	})
+
+	if errors.Is(err, errNotStreamable) {
+		return nil, nil, nil
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return h, upstream, nil
+}
+
+// proxyUpstream is opened on the first read of entry data.
+type proxyUpstream struct {
+	p  *Proxy
+	r  *http.Request
+	rc io.ReadCloser
+	sr *StreamReader
+}
+
+// copy writes raw data of the entry at header offset, previous entries are skipped.
+func (u *proxyUpstream) copy(offset int64, w io.Writer) error {
+	if u.sr == nil {
+		rc, err := u.p.Open(u.r)
+		if err != nil {
+			return err
+		}
+
+		u.rc = rc
+		u.sr = u.p.reader(rc)
+	}
+
+	for {
+		e, err := u.sr.Next()
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("upstream entry at offset %d: %w", offset, io.ErrUnexpectedEOF)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if e.HeaderOffset() != offset {
+			continue
+		}
+
+		r, err := e.OpenRaw()
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(w, r)
+
+		return err
+	}
+}
+
+func (u *proxyUpstream) close() {
+	if u.rc == nil {
+		return
+	}
+
+	if err := u.rc.Close(); err != nil {
+		u.p.OnError(err)
+	}
+}
+
+// copyEntry writes raw entry data with data descriptor if sizes are unknown in advance.
+func copyEntry(w *zip.Writer, e *Entry, name string) error {
+	fh := &zip.FileHeader{
+		Name:               name,
+		Comment:            e.Comment,
+		Method:             e.Method,
+		Flags:              e.Flags & 0x9, // Encryption and data descriptor, password check byte depends on the latter.
+		ModifiedTime:       e.ModifiedTime,
+		ModifiedDate:       e.ModifiedDate,
+		CreatorVersion:     e.CreatorVersion,
+		ReaderVersion:      max(e.ReaderVersion, zipVersion20),
+		ExternalAttrs:      e.ExternalAttrs,
+		CRC32:              e.CRC32,
+		CompressedSize64:   e.CompressedSize64,
+		UncompressedSize64: e.UncompressedSize64,
+		Extra:              copyExtra(e.Extra),
+	}
+
+	// Unlike CreateHeader, CreateRaw does not detect UTF-8 names.
+	if !isASCII(name) || !isASCII(e.Comment) {
+		fh.Flags |= flagUTF8
+	}
+
+	if e.unknownSize {
+		fh.Flags |= 0x8
+	}
+
+	f, err := w.CreateRaw(fh)
+	if err != nil {
+		return err
+	}
+
+	r, err := e.OpenRaw()
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+
+	// Data descriptor is written from file header on next entry or archive close,
+	// zip.Writer takes 32-bit sizes from deprecated fields.
+	fh.CRC32 = e.CRC32
+	fh.CompressedSize64 = e.CompressedSize64
+	fh.UncompressedSize64 = e.UncompressedSize64
+	fh.CompressedSize = e.CompressedSize
+	fh.UncompressedSize = e.UncompressedSize
+
+	return nil
+}
+
+// copyExtra returns extra fields without those that are rewritten by zip.Writer or are stale after renaming.
+func copyExtra(extra []byte) []byte {
+	var res []byte
+
+	for b := readBuf(extra); len(b) >= 4; {
+		field := []byte(b[:4])
+		id := b.uint16()
+		size := int(b.uint16())
+
+		if len(b) < size {
+			break
+		}
+
+		data := b.sub(size)
+
+		switch id {
+		case Zip64ExtraID, UnicodePathExtraID, UnicodeCommentExtraID:
+			continue
+		}
+
+		res = append(res, field...)
+		res = append(res, data...)
+	}
+
+	return res
+}
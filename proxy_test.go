@@ -0,0 +1,251 @@
+package httpzip_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/vearutop/httpzip"
+)
+
+type seekCounter struct {
+	*bytes.Reader
+	seeks int
+}
+
+func (s *seekCounter) Seek(offset int64, whence int) (int64, error) {
+	s.seeks++
+
+	return s.Reader.Seek(offset, whence)
+}
+
+func (s *seekCounter) Close() error {
+	return nil
+}
+
+func proxyContents(t *testing.T, body []byte) map[string]string {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := map[string]string{}
+
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contents[f.Name] = string(c)
+	}
+
+	// Served archive is also readable as a stream.
+	entries, err := readAll(httpzip.NewStreamReader(bytes.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != len(contents) {
+		t.Fatalf("unexpected entries: %d", len(entries))
+	}
+
+	return contents
+}
+
+func TestProxy_ServeHTTP(t *testing.T) {
+	archive, contents := mixedArchive(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		_, _ = rw.Write(archive)
+	}))
+	defer upstream.Close()
+
+	p := httpzip.NewProxy("subset", func(*http.Request) (io.ReadCloser, error) {
+		resp, err := http.Get(upstream.URL) //nolint:noctx
+		if err != nil {
+			return nil, err
+		}
+
+		return resp.Body, nil
+	})
+	p.Select.Exclude = []string{"store-*"}
+	p.Rename = func(e *httpzip.Entry) string {
+		return "out/" + e.Name
+	}
+	p.Streamable = true // Upstream has data descriptors, so archive is not streamable.
+
+	rw := httptest.NewRecorder()
+	p.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rw.Header().Get("Content-Length") != "" {
+		t.Fatal("unexpected Content-Length")
+	}
+
+	if rw.Header().Get("Content-Disposition") != `attachment; filename="subset.zip"` {
+		t.Fatalf("unexpected Content-Disposition: %s", rw.Header().Get("Content-Disposition"))
+	}
+
+	served := proxyContents(t, rw.Body.Bytes())
+
+	if len(served) != 2 || served["out/deflate-dd.txt"] != contents["deflate-dd.txt"] ||
+		served["out/deflate.txt"] != contents["deflate.txt"] {
+		t.Fatalf("unexpected entries: %v", len(served))
+	}
+}
+
+func TestProxy_ServeHTTP_streamable(t *testing.T) {
+	h := httpzip.NewHandler("upstream")
+	h.Streamable = true
+
+	for _, name := range []string{"a.txt", "docs/b.md", "docs/c.md"} {
+		content := strings.Repeat(name, 10000)
+
+		if err := h.AddFile(httpzip.FileSource{
+			Path:    name,
+			Size:    int64(len(content)),
+			Mode:    0o640,
+			Comment: "comment of " + name,
+			Extra:   extraField(0xcafe, []byte(name)),
+			Data: func(w io.Writer) error {
+				_, err := w.Write([]byte(content))
+
+				return err
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, nil)
+
+	archive := rw.Body.Bytes()
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f := zr.File[0]; f.Mode() != 0o640 || f.Comment != "comment of a.txt" {
+		t.Fatalf("unexpected upstream header: %+v", f.FileHeader)
+	}
+
+	var opened []*seekCounter
+
+	p := httpzip.NewProxy("docs", func(*http.Request) (io.ReadCloser, error) {
+		s := &seekCounter{Reader: bytes.NewReader(archive)}
+		opened = append(opened, s)
+
+		return s, nil
+	})
+	p.Select.Include = []string{"docs/**"}
+	p.Rename = func(e *httpzip.Entry) string {
+		if e.Name == "docs/c.md" {
+			return ""
+		}
+
+		return strings.TrimPrefix(e.Name, "docs/")
+	}
+	p.Streamable = true
+
+	rw = httptest.NewRecorder()
+	p.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rw.Header().Get("Content-Length") != strconv.Itoa(rw.Body.Len()) {
+		t.Fatalf("unexpected Content-Length: %s, %d", rw.Header().Get("Content-Length"), rw.Body.Len())
+	}
+
+	// Data is seeked over while collecting headers.
+	if len(opened) != 2 || opened[0].seeks == 0 {
+		t.Fatalf("unexpected upstream reads: %d", len(opened))
+	}
+
+	served := proxyContents(t, rw.Body.Bytes())
+
+	if len(served) != 1 || served["b.md"] != strings.Repeat("docs/b.md", 10000) {
+		t.Fatalf("unexpected entries: %d", len(served))
+	}
+
+	entries, err := readAll(httpzip.NewStreamReader(bytes.NewReader(rw.Body.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entries[0].HasDataDescriptor() {
+		t.Fatal("data descriptor is not expected in streamable archive")
+	}
+
+	zr, err = zip.NewReader(bytes.NewReader(rw.Body.Bytes()), int64(rw.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Extra fields are copied like in non-streamable archive, comment and mode are only available
+	// in upstream central directory.
+	if !bytes.Equal(zr.File[0].Extra, extraField(0xcafe, []byte("docs/b.md"))) {
+		t.Fatalf("unexpected header: %+v", zr.File[0].FileHeader)
+	}
+}
+
+func TestProxy_ServeHTTP_encrypted(t *testing.T) {
+	for _, method := range []httpzip.EncryptionMethod{httpzip.AES256, httpzip.ZipCrypto} {
+		h := httpzip.NewHandler("upstream")
+		h.Encryption = &httpzip.Encryption{Password: "secret", Method: method}
+
+		if err := h.AddFile(httpzip.FileSource{
+			Path: "secret.txt",
+			Size: 5,
+			Data: func(w io.Writer) error {
+				_, err := w.Write([]byte("hello"))
+
+				return err
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, nil)
+
+		archive := rw.Body.Bytes()
+
+		p := httpzip.NewProxy("copy", func(*http.Request) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(archive)), nil
+		})
+		p.Streamable = true // Encrypted entries are not streamable.
+
+		rw = httptest.NewRecorder()
+		p.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		sr := httpzip.NewStreamReader(bytes.NewReader(rw.Body.Bytes()))
+		sr.Password = func(*httpzip.Entry) (string, error) { return "secret", nil }
+
+		e, err := sr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rc, err := e.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := io.ReadAll(rc)
+		if err != nil || string(c) != "hello" {
+			t.Fatalf("method %d: unexpected contents %q, %v", method, c, err)
+		}
+	}
+}
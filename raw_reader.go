@@ -0,0 +1,160 @@
+package httpzip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// OpenRaw returns entry data as it is stored in archive, without decryption and decompression.
+//
+// Data descriptor is consumed after the end of data. End of compressed data of unknown size
+// can only be found by decompressing it, such entries are decompressed and verified in background,
+// so Password may be needed for encrypted entries. With StrictChecksum all entries are verified this way.
+func (e *Entry) OpenRaw() (io.Reader, error) {
+	if e.eof {
+		return nil, ErrEntryConsumed
+	}
+
+	if e.rc != nil || e.raw != nil {
+		return nil, ErrEntryOpened
+	}
+
+	r := &rawReader{entry: e, src: e.lr}
+
+	// Stored data of unknown size is scanned for data descriptor instead of decompression.
+	_, scan := e.lr.(*storedReader)
+
+	if !scan && (e.unknownSize || e.z.StrictChecksum) {
+		lr := e.lr
+		r.tee = &teeReader{r: e.z.r}
+
+		if e.unknownSize {
+			e.lr = r.tee
+		} else {
+			e.lr = io.LimitReader(r.tee, int64(e.CompressedSize64))
+		}
+
+		rc, err := e.Open()
+		if err != nil {
+			e.lr = lr
+
+			if e.z.StrictChecksum {
+				err = &UnverifiedError{Entry: e.Name, Err: err}
+			}
+
+			return nil, err
+		}
+
+		r.src = rc
+		r.scratch = make([]byte, 32*1024)
+	}
+
+	e.raw = r
+
+	return r, nil
+}
+
+// rawReader reads stored bytes of entry data.
+type rawReader struct {
+	entry *Entry
+	src   io.Reader // Raw data, or decompressed data if tee is set.
+	n     uint64
+
+	tee     *teeReader
+	scratch []byte
+
+	err error
+}
+
+func (r *rawReader) Read(p []byte) (int, error) {
+	if r.tee != nil {
+		return r.readTee(p)
+	}
+
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := r.src.Read(p)
+	r.n += uint64(n)
+
+	if err == io.EOF {
+		err = r.finish()
+	}
+
+	r.err = err
+
+	return n, err
+}
+
+// readTee decompresses data until compressed bytes are available.
+func (r *rawReader) readTee(p []byte) (int, error) {
+	for r.tee.buf.Len() == 0 && r.err == nil {
+		_, r.err = r.src.Read(r.scratch)
+	}
+
+	if r.tee.buf.Len() > 0 {
+		return r.tee.buf.Read(p)
+	}
+
+	return 0, r.err
+}
+
+// finish reads data descriptor after the end of data.
+func (r *rawReader) finish() error {
+	e := r.entry
+
+	if sr, ok := r.src.(*storedReader); ok {
+		if err := readDataDescriptor(e, sr.n-uint64(e.encryptionOverhead())); err != nil {
+			return err
+		}
+
+		// Scanner only accepts data descriptor with CRC32 of plain data.
+		e.verified = e.Flags&1 == 0
+
+		return io.EOF
+	}
+
+	if r.n != e.CompressedSize64 {
+		return &FormatError{
+			Offset: e.dataOffset,
+			Entry:  e.Name,
+			Record: RecordFileData,
+			Err:    fmt.Errorf("%w: %d of %d bytes", io.ErrUnexpectedEOF, r.n, e.CompressedSize64),
+		}
+	}
+
+	if e.hasDataDescriptor() {
+		if err := readDataDescriptor(e, 0); err != nil {
+			return err
+		}
+	}
+
+	e.eof = true
+
+	return io.EOF
+}
+
+// teeReader keeps bytes that are read from the stream.
+type teeReader struct {
+	r   *offsetReader
+	buf bytes.Buffer
+}
+
+func (t *teeReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.buf.Write(p[:n])
+
+	return n, err
+}
+
+// ReadByte allows decompressor to stop exactly at the end of compressed data.
+func (t *teeReader) ReadByte() (byte, error) {
+	b, err := t.r.ReadByte()
+	if err == nil {
+		t.buf.WriteByte(b)
+	}
+
+	return b, err
+}
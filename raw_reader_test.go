@@ -0,0 +1,136 @@
+package httpzip_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vearutop/httpzip"
+)
+
+func mixedArchive(t *testing.T) ([]byte, map[string]string) {
+	t.Helper()
+
+	contents := map[string]string{
+		"deflate-dd.txt": strings.Repeat("hello deflate ", 1000),
+		"store-dd.txt":   "hello store",
+		"deflate.txt":    strings.Repeat("hello known size ", 1000),
+	}
+
+	archive := zipArchive(t,
+		zipEntry{name: "deflate-dd.txt", data: []byte(contents["deflate-dd.txt"]), method: zip.Deflate},
+		zipEntry{name: "store-dd.txt", data: []byte(contents["store-dd.txt"]), method: zip.Store},
+		zipEntry{name: "deflate.txt", data: []byte(contents["deflate.txt"]), method: zip.Deflate, raw: true},
+	)
+
+	return archive, contents
+}
+
+func TestEntry_OpenRaw(t *testing.T) {
+	archive, contents := mixedArchive(t)
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]byte{}
+
+	for _, f := range zr.File {
+		r, err := f.OpenRaw()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected[f.Name], _ = io.ReadAll(r)
+	}
+
+	for _, strict := range []bool{false, true} {
+		sr := httpzip.NewStreamReader(bytes.NewReader(archive))
+		sr.StrictChecksum = strict
+
+		h := httpzip.NewHandler("copy")
+		h.Streamable = strict // Both modes write raw entries.
+
+		for e, err := range sr.All() {
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := e.OpenRaw()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			raw, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(raw, expected[e.Name]) {
+				t.Fatalf("unexpected raw data of %s", e.Name)
+			}
+
+			if e.CompressedSize64 != uint64(len(raw)) || e.UncompressedSize64 != uint64(len(contents[e.Name])) {
+				t.Fatalf("unexpected sizes of %s: %d, %d", e.Name, e.CompressedSize64, e.UncompressedSize64)
+			}
+
+			// Data of unknown size is always verified, because its end is found by decompression or CRC32.
+			if e.Verified() != (strict || e.HasDataDescriptor()) {
+				t.Fatalf("unexpected verification of %s", e.Name)
+			}
+
+			if err := h.AddFile(httpzip.FileSource{
+				Path:           e.Name,
+				Size:           int64(e.UncompressedSize64),
+				CRC32:          e.CRC32,
+				Raw:            true,
+				Method:         e.Method,
+				CompressedSize: int64(len(raw)),
+				Data: func(w io.Writer) error {
+					_, err := w.Write(raw)
+
+					return err
+				},
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, nil)
+
+		copied, err := readAll(httpzip.NewStreamReader(bytes.NewReader(rw.Body.Bytes())))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(copied) != 3 {
+			t.Fatalf("unexpected entries: %d", len(copied))
+		}
+
+		zr, err := zip.NewReader(bytes.NewReader(rw.Body.Bytes()), int64(rw.Body.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(c) != contents[f.Name] {
+				t.Fatalf("unexpected contents of %s", f.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package httpzip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// storedReader reads stored entry data of unknown size.
+//
+// Data is scanned for data descriptor signature, candidate descriptor is only accepted
+// if it matches CRC32 and size of preceding data and is followed by a valid record signature.
+type storedReader struct {
+	r     *offsetReader
+	entry *Entry
+	crc   uint32 // CRC32 of data read so far.
+	n     uint64 // Number of bytes read so far.
+	done  bool
+}
+
+var dataDescriptorSig = []byte{'P', 'K', 0x07, 0x08}
+
+const storedPeekLen = 4096
+
+func (s *storedReader) Read(p []byte) (int, error) {
+	if s.done {
+		return 0, io.EOF
+	}
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	buf, err := s.r.peek(storedPeekLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+
+	i := bytes.Index(buf, dataDescriptorSig)
+
+	if i == 0 {
+		ok, err := s.descriptorMatches()
+		if err != nil {
+			return 0, err
+		}
+
+		if ok {
+			s.done = true
+
+			return 0, io.EOF
+		}
+
+		// False positive, signature is a part of data.
+		if i = bytes.Index(buf[1:], dataDescriptorSig); i >= 0 {
+			i++
+		}
+	}
+
+	safe := i
+
+	if i < 0 {
+		// Last bytes can be a beginning of signature.
+		safe = len(buf) - len(dataDescriptorSig) + 1
+
+		if err != nil {
+			// Stream ended without data descriptor.
+			return 0, &FormatError{
+				Offset: s.entry.dataOffset,
+				Entry:  s.entry.Name,
+				Record: RecordFileData,
+				Err:    fmt.Errorf("%w: data descriptor not found", io.ErrUnexpectedEOF),
+			}
+		}
+	}
+
+	if safe > len(p) {
+		safe = len(p)
+	}
+
+	n, err := io.ReadFull(s.r, p[:safe])
+	s.crc = crc32.Update(s.crc, crc32.IEEETable, p[:n])
+	s.n += uint64(n)
+
+	return n, err
+}
+
+// descriptorMatches checks if data descriptor at current position describes data that was read.
+func (s *storedReader) descriptorMatches() (bool, error) {
+	buf, err := s.r.peek(dataDescriptor64Len + headerIdentifierLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+
+	compressedSize := s.n
+	uncompressedSize := s.n - uint64(s.entry.encryptionOverhead())
+	checkCRC := s.entry.Flags&1 == 0 // CRC32 of encrypted entry is calculated for decrypted data.
+
+	matches := func(crc uint32, cs, us uint64, next []byte) bool {
+		if cs != compressedSize || us != uncompressedSize || (checkCRC && crc != s.crc) {
+			return false
+		}
+
+		// Data descriptor is followed by next record or by the end of stream.
+		if len(next) == 0 {
+			return true
+		}
+
+		if len(next) < headerIdentifierLen {
+			return false
+		}
+
+		sig := binary.LittleEndian.Uint32(next)
+
+		return sig == fileHeaderSignature || isEndSignature(sig)
+	}
+
+	if len(buf) < dataDescriptorLen {
+		return false, nil
+	}
+
+	crc := binary.LittleEndian.Uint32(buf[4:])
+
+	if matches(crc, uint64(binary.LittleEndian.Uint32(buf[8:])), uint64(binary.LittleEndian.Uint32(buf[12:])), buf[dataDescriptorLen:]) {
+		return true, nil
+	}
+
+	if len(buf) < dataDescriptor64Len {
+		return false, nil
+	}
+
+	return matches(crc, binary.LittleEndian.Uint64(buf[8:]), binary.LittleEndian.Uint64(buf[16:]), buf[dataDescriptor64Len:]), nil
+}
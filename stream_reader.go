@@ -35,8 +35,7 @@ package httpzip
 
 import (
 	"archive/zip"
-	"bytes"
-	"compress/flate"
+	"bufio"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -51,9 +50,12 @@ const (
 	fileHeaderLen       = 26
 
 	dataDescriptorLen        = 16 // four uint32: descriptor signature, crc32, compressed size, size
+	dataDescriptor64Len      = 24 // two uint32: signature, crc32 | two uint64: compressed size, size
 	fileHeaderSignature      = 0x04034b50
 	directoryHeaderSignature = 0x02014b50
 	directoryEndSignature    = 0x06054b50
+	directory64EndSignature  = 0x06064b50
+	directory64LocSignature  = 0x07064b50
 	dataDescriptorSignature  = 0x08074b50
 )
 
@@ -65,23 +67,64 @@ const (
 	UnixExtraID        = 0x000d // UNIX.
 	ExtTimeExtraID     = 0x5455 // Extended timestamp.
 	InfoZipUnixExtraID = 0x5855 // Info-ZIP Unix extension.
+	AESExtraID         = 0x9901 // WinZip AES encryption.
+)
+
+// TimeSource identifies header field that provided entry modification time.
+type TimeSource string
+
+// Modification time sources.
+const (
+	TimeSourceDOS     = TimeSource("DOS")     // MS-DOS date and time of local file header.
+	TimeSourceNTFS    = TimeSource("NTFS")    // NTFS extra field.
+	TimeSourceUnix    = TimeSource("Unix")    // UNIX or Info-ZIP Unix extra field.
+	TimeSourceExtTime = TimeSource("ExtTime") // Extended timestamp extra field.
 )
 
 // Entry represents a file or directory in ZIP archive.
 type Entry struct {
 	zip.FileHeader
-	r                          io.Reader
-	lr                         io.Reader // LimitReader
-	zip64                      bool
-	hasReadNum                 uint64
-	hasDataDescriptorSignature bool
-	eof                        bool
+
+	// ModifiedSource is a header field that provided Modified value.
+	ModifiedSource TimeSource
+
+	z            *StreamReader
+	aes          *aesInfo
+	headerOffset int64
+	dataOffset   int64
+	lr           io.Reader // LimitReader, or stream itself if compressed size is unknown.
+	rc           *checksumReader
+	raw          *rawReader
+	zip64        bool
+	unknownSize  bool // Sizes are only available in data descriptor.
+	eof          bool
+	verified     bool
 }
 
 func (e *Entry) hasDataDescriptor() bool {
 	return e.Flags&8 != 0
 }
 
+// HasDataDescriptor returns true if entry sizes and CRC32 are stored after entry data.
+func (e *Entry) HasDataDescriptor() bool {
+	return e.hasDataDescriptor()
+}
+
+// IsZip64 returns true if entry has Zip64 extended information.
+func (e *Entry) IsZip64() bool {
+	return e.zip64
+}
+
+// HeaderOffset returns position of local file header in the stream.
+func (e *Entry) HeaderOffset() int64 {
+	return e.headerOffset
+}
+
+// Verified returns true if entry data was read and matched CRC32 or AES authentication code.
+func (e *Entry) Verified() bool {
+	return e.verified
+}
+
 // IsDir returns true for directories.
 func (e *Entry) IsDir() bool {
 	return len(e.Name) > 0 && e.Name[len(e.Name)-1] == '/'
@@ -90,41 +133,230 @@ func (e *Entry) IsDir() bool {
 // Open opens entry contents for reading.
 func (e *Entry) Open() (io.ReadCloser, error) {
 	if e.eof {
-		return nil, errors.New("this file has read to end")
+		return nil, ErrEntryConsumed
 	}
 
-	decomp := decompressor(e.Method)
-	if decomp == nil {
-		return nil, zip.ErrAlgorithm
+	if e.rc != nil || e.raw != nil {
+		return nil, ErrEntryOpened
+	}
+
+	if err := e.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	src := e.lr
+	method := e.Method
+
+	if e.Flags&1 != 0 {
+		var err error
+
+		if src, method, err = e.decrypt(src); err != nil {
+			return nil, err
+		}
 	}
 
-	rc := decomp(e.lr)
+	// End of data of unknown size is found by decompressor that stops at the end of compressed stream,
+	// other decompressors (for example BZIP2) read ahead and consume data descriptor.
+	if e.unknownSize && method != zip.Store && method != zip.Deflate && method != Deflate64 {
+		return nil, &UnsupportedMethodError{Entry: e.Name, Method: method}
+	}
 
-	return &checksumReader{
-		rc:    rc,
+	decomp := e.z.decompressor(method)
+	if decomp == nil {
+		return nil, &UnsupportedMethodError{Entry: e.Name, Method: method}
+	}
+
+	e.rc = &checksumReader{
+		rc:    decomp(src),
 		hash:  crc32.NewIEEE(),
 		entry: e,
-	}, nil
+	}
+
+	// Remaining compressed data can only be skipped if its size is known.
+	if !e.unknownSize {
+		e.rc.src = src
+	}
+
+	return e.rc, nil
+}
+
+// skip consumes the rest of entry data and data descriptor.
+func (e *Entry) skip() error {
+	if e.eof {
+		return nil
+	}
+
+	if e.raw != nil {
+		if _, err := io.Copy(io.Discard, e.raw); err != nil {
+			return fmt.Errorf("read previous file data fail: %w", err)
+		}
+
+		return nil
+	}
+
+	strict := e.z.StrictChecksum
+	encrypted := e.Flags&1 != 0
+
+	if sr, ok := e.lr.(*storedReader); ok && e.rc == nil && (!strict || !encrypted) {
+		// Stored data is scanned for data descriptor without decryption.
+		if _, err := io.Copy(io.Discard, sr); err != nil {
+			return fmt.Errorf("read previous file data fail: %w", err)
+		}
+
+		if err := readDataDescriptor(e, sr.n-uint64(e.encryptionOverhead())); err != nil {
+			return fmt.Errorf("read previous entry's data descriptor fail: %w", err)
+		}
+
+		// Scanner only accepts data descriptor with CRC32 of plain data.
+		e.verified = !encrypted
+
+		return nil
+	}
+
+	// End of data of unknown size can only be found by decompressing it,
+	// strict mode decompresses every entry to verify it.
+	if e.unknownSize || strict {
+		if e.rc == nil {
+			rc, err := e.Open()
+			if err != nil {
+				if strict {
+					err = &UnverifiedError{Entry: e.Name, Err: err}
+				}
+
+				return fmt.Errorf("read previous file data fail: %w", err)
+			}
+
+			defer rc.Close() //nolint:errcheck // Data is read to the end, decompressor is released.
+		}
+
+		// Closed reader has already consumed data, its result is sticky.
+		if _, err := io.Copy(io.Discard, e.rc); err != nil && (strict || !errors.Is(err, zip.ErrChecksum)) {
+			return fmt.Errorf("read previous file data fail: %w", err)
+		}
+
+		return nil
+	}
+
+	if l, ok := e.lr.(*io.LimitedReader); ok {
+		if err := e.z.r.discard(l.N); err != nil {
+			return fmt.Errorf("read previous file data fail: %w", readError(e.dataOffset, e.Name, RecordFileData, err))
+		}
+
+		l.N = 0
+	}
+
+	if e.hasDataDescriptor() {
+		if err := readDataDescriptor(e, 0); err != nil {
+			return fmt.Errorf("read previous entry's data descriptor fail: %w", err)
+		}
+	}
+
+	e.eof = true
+
+	return nil
 }
 
 // StreamReader can read ZIP contents from a io.Reader.
 type StreamReader struct {
-	r            io.Reader
-	localFileEnd bool
-	curEntry     *Entry
+	r             *offsetReader
+	localFileEnd  bool
+	curEntry      *Entry
+	decompressors map[uint16]zip.Decompressor
+	entries       []*Entry
+	directory     *CentralDirectory
+	numEntries    int
+	depth         int
+	usage         *usage
+
+	// Password is called to get password for an encrypted entry when it is opened.
+	Password func(e *Entry) (string, error)
+
+	// ReadCentralDirectory enables reading of central directory after the last local entry.
+	// Central directory is checked against local entries and Next returns *ValidationError
+	// instead of io.EOF if there are mismatches.
+	ReadCentralDirectory bool
+
+	// StrictChecksum requires every entry to match CRC32 from local header or data descriptor,
+	// even if it is zero. Entries that were not read are decompressed by Next to be verified,
+	// Next fails with *UnverifiedError if that is not possible, for example without password.
+	StrictChecksum bool
+
+	// LegacyDecoder converts names and comments without UTF-8 flag and Info-ZIP Unicode extra fields,
+	// for example charmap.CodePage866.NewDecoder().Bytes from golang.org/x/text.
+	// By default, names that are not valid UTF-8 are decoded with DecodeCP437.
+	LegacyDecoder func(b []byte) ([]byte, error)
+
+	// Limits restricts resources consumed by decompression, violations fail with *LimitError.
+	Limits Limits
 }
 
 // NewStreamReader returns streaming ZIP reader.
 func NewStreamReader(r io.Reader) *StreamReader {
 	return &StreamReader{
-		r: r,
+		r:     &offsetReader{br: bufio.NewReader(r), src: r},
+		usage: &usage{},
 	}
 }
 
-func (z *StreamReader) readEntry() (*Entry, error) {
+// Offset returns number of bytes consumed from the stream.
+func (z *StreamReader) Offset() int64 {
+	return z.r.n
+}
+
+// offsetReader counts bytes consumed from the buffered stream.
+//
+// It implements io.ByteReader, so that decompressors can read exactly to the end
+// of compressed data without consuming following records.
+type offsetReader struct {
+	br  *bufio.Reader
+	src io.Reader
+	n   int64
+}
+
+func (o *offsetReader) Read(p []byte) (int, error) {
+	n, err := o.br.Read(p)
+	o.n += int64(n)
+
+	return n, err
+}
+
+// peek returns next n bytes without consuming them, fewer bytes are returned with an error.
+func (o *offsetReader) peek(n int) ([]byte, error) {
+	return o.br.Peek(n)
+}
+
+// discard skips n bytes, source that implements io.Seeker is seeked instead of being read.
+func (o *offsetReader) discard(n int64) error {
+	buffered := int64(o.br.Buffered())
+
+	if s, ok := o.src.(io.Seeker); ok && n > buffered {
+		// Seek fails for pipes and other non-seekable files, they are read instead.
+		if _, err := s.Seek(n-buffered, io.SeekCurrent); err == nil {
+			o.br.Reset(o.src)
+			o.n += n
+
+			return nil
+		}
+	}
+
+	_, err := io.CopyN(io.Discard, o, n)
+
+	return err
+}
+
+func (o *offsetReader) ReadByte() (byte, error) {
+	b, err := o.br.ReadByte()
+	if err == nil {
+		o.n++
+	}
+
+	return b, err
+}
+
+func (z *StreamReader) readEntry(headerOffset int64) (*Entry, error) {
 	buf := make([]byte, fileHeaderLen)
 	if _, err := io.ReadFull(z.r, buf); err != nil {
-		return nil, fmt.Errorf("unable to read local file header: %w", err)
+		return nil, readError(headerOffset, "", RecordLocalHeader, err)
 	}
 
 	lr := readBuf(buf)
@@ -140,6 +372,10 @@ func (z *StreamReader) readEntry() (*Entry, error) {
 	filenameLen := int(lr.uint16())
 	extraAreaLen := int(lr.uint16())
 
+	if err := z.checkHeader(filenameLen, extraAreaLen); err != nil {
+		return nil, err
+	}
+
 	entry := &Entry{
 		FileHeader: zip.FileHeader{
 			ReaderVersion:      readerVersion,
@@ -154,29 +390,25 @@ func (z *StreamReader) readEntry() (*Entry, error) {
 			CompressedSize64:   uint64(compressedSize),
 			UncompressedSize64: uint64(uncompressedSize),
 		},
-		r:          z.r,
-		hasReadNum: 0,
-		eof:        false,
+		z:            z,
+		headerOffset: headerOffset,
 	}
 
 	nameAndExtraBuf := make([]byte, filenameLen+extraAreaLen)
 	if _, err := io.ReadFull(z.r, nameAndExtraBuf); err != nil {
-		return nil, fmt.Errorf("unable to read entry name and extra area: %w", err)
+		return nil, readError(headerOffset, "", RecordLocalHeader, err)
 	}
 
-	entry.Name = string(nameAndExtraBuf[:filenameLen])
 	entry.Extra = nameAndExtraBuf[filenameLen:]
-	entry.NonUTF8 = flags&0x800 == 0
-
-	if flags&1 == 1 {
-		return nil, errors.New("encrypted ZIP entry not supported")
-	}
+	entry.Name = z.decodeText(nameAndExtraBuf[:filenameLen], flags, entry.Extra, UnicodePathExtraID)
+	entry.NonUTF8 = flags&flagUTF8 == 0
 
 	needCSize := entry.CompressedSize == ^uint32(0)
 	needUSize := entry.UncompressedSize == ^uint32(0)
 
 	ler := readBuf(entry.Extra)
 	modified := time.Time{}
+	modifiedSource := TimeSourceDOS
 parseExtras:
 	for len(ler) >= 4 { // need at least tag and size
 		fieldTag := ler.uint16()
@@ -197,39 +429,23 @@ parseExtras:
 			if needUSize {
 				needUSize = false
 				if len(fieldBuf) < 8 {
-					return nil, zip.ErrFormat
+					return nil, entry.extraError(Zip64ExtraID)
 				}
 				entry.UncompressedSize64 = fieldBuf.uint64()
 			}
 			if needCSize {
 				needCSize = false
 				if len(fieldBuf) < 8 {
-					return nil, zip.ErrFormat
+					return nil, entry.extraError(Zip64ExtraID)
 				}
 				entry.CompressedSize64 = fieldBuf.uint64()
 			}
 		case NtfsExtraID:
-			if len(fieldBuf) < 4 {
-				continue parseExtras
-			}
-			fieldBuf.uint32()        // reserved (ignored)
-			for len(fieldBuf) >= 4 { // need at least tag and size
-				attrTag := fieldBuf.uint16()
-				attrSize := int(fieldBuf.uint16())
-				if len(fieldBuf) < attrSize {
-					continue parseExtras
-				}
-				attrBuf := fieldBuf.sub(attrSize)
-				if attrTag != 1 || attrSize != 24 {
-					continue // Ignore irrelevant attributes
+			for _, ts := range ntfsTimes(fieldBuf) {
+				if ts.Kind == TimeModified {
+					modified = ts.Time
+					modifiedSource = TimeSourceNTFS
 				}
-
-				const ticksPerSecond = 1e7    // Windows timestamp resolution
-				ts := int64(attrBuf.uint64()) // ModTime since Windows epoch
-				secs := ts / ticksPerSecond
-				nsecs := (1e9 / ticksPerSecond) * ts % ticksPerSecond
-				epoch := time.Date(1601, time.January, 1, 0, 0, 0, 0, time.UTC)
-				modified = time.Unix(epoch.Unix()+secs, nsecs)
 			}
 		case UnixExtraID, InfoZipUnixExtraID:
 			if len(fieldBuf) < 8 {
@@ -238,15 +454,29 @@ parseExtras:
 			fieldBuf.uint32()              // AcTime (ignored)
 			ts := int64(fieldBuf.uint32()) // ModTime since Unix epoch
 			modified = time.Unix(ts, 0)
+			modifiedSource = TimeSourceUnix
 		case ExtTimeExtraID:
 			if len(fieldBuf) < 5 || fieldBuf.uint8()&1 == 0 {
 				continue parseExtras
 			}
 			ts := int64(fieldBuf.uint32()) // ModTime since Unix epoch
 			modified = time.Unix(ts, 0)
+			modifiedSource = TimeSourceExtTime
+		case AESExtraID:
+			if len(fieldBuf) < 7 {
+				return nil, entry.extraError(AESExtraID)
+			}
+
+			entry.aes = &aesInfo{}
+			entry.aes.version = fieldBuf.uint16()
+			fieldBuf.uint16() // Vendor ID (ignored)
+			entry.aes.strength = fieldBuf.uint8()
+			entry.aes.method = fieldBuf.uint16()
 		}
 	}
 
+	entry.ModifiedSource = modifiedSource
+
 	if !modified.IsZero() {
 		entry.Modified = modified.UTC()
 
@@ -264,7 +494,23 @@ parseExtras:
 	}
 
 	if needCSize {
-		return nil, zip.ErrFormat
+		return nil, entry.extraError(Zip64ExtraID)
+	}
+
+	entry.dataOffset = z.r.n
+
+	// Streaming writers put zero sizes in local header and store them in data descriptor.
+	// Self-terminating compressed data is then read from the stream without a limit,
+	// stored data is scanned for a matching data descriptor.
+	if entry.hasDataDescriptor() && entry.CompressedSize64 == 0 {
+		entry.unknownSize = true
+		entry.lr = z.r
+
+		if entry.Method == zip.Store {
+			entry.lr = &storedReader{r: z.r, entry: entry}
+		}
+
+		return entry, nil
 	}
 
 	entry.lr = io.LimitReader(z.r, int64(entry.CompressedSize64))
@@ -279,95 +525,94 @@ func (z *StreamReader) Next() (*Entry, error) {
 	}
 
 	if z.curEntry != nil && !z.curEntry.eof {
-		if z.curEntry.hasReadNum <= z.curEntry.UncompressedSize64 {
-			if _, err := io.Copy(io.Discard, z.curEntry.lr); err != nil {
-				return nil, fmt.Errorf("read previous file data fail: %w", err)
-			}
-
-			if z.curEntry.hasDataDescriptor() {
-				if err := readDataDescriptor(z.r, z.curEntry); err != nil {
-					return nil, fmt.Errorf("read previous entry's data descriptor fail: %w", err)
-				}
-			}
-		} else {
-			if !z.curEntry.hasDataDescriptor() {
-				return nil, errors.New("parse error, read position exceed entry")
-			}
-
-			readDataLen := z.curEntry.hasReadNum - z.curEntry.UncompressedSize64
-			if readDataLen > dataDescriptorLen {
-				return nil, errors.New("parse error, read position exceed entry")
-			} else if readDataLen > dataDescriptorLen-4 {
-				if z.curEntry.hasDataDescriptorSignature {
-					if _, err := io.Copy(io.Discard, io.LimitReader(z.r, int64(dataDescriptorLen-readDataLen))); err != nil {
-						return nil, fmt.Errorf("read previous entry's data descriptor fail: %w", err)
-					}
-				} else {
-					return nil, errors.New("parse error, read position exceed entry")
-				}
-			} else {
-				buf := make([]byte, dataDescriptorLen-readDataLen)
-				if _, err := io.ReadFull(z.r, buf); err != nil {
-					return nil, fmt.Errorf("read previous entry's data descriptor fail: %w", err)
-				}
-
-				buf = buf[len(buf)-4:]
-
-				headerID := binary.LittleEndian.Uint32(buf)
-
-				// read to next record head
-				if headerID == fileHeaderSignature ||
-					headerID == directoryHeaderSignature ||
-					headerID == directoryEndSignature {
-					z.r = io.MultiReader(bytes.NewReader(buf), z.r)
-				}
-			}
+		if err := z.curEntry.skip(); err != nil {
+			return nil, err
 		}
-
-		z.curEntry.eof = true
 	}
 
+	headerOffset := z.r.n
 	headerIDBuf := make([]byte, headerIdentifierLen)
 
 	if _, err := io.ReadFull(z.r, headerIDBuf); err != nil {
-		return nil, fmt.Errorf("unable to read header identifier: %w", err)
+		// Stream that ends on entry boundary without central directory is not an error.
+		if err == io.EOF {
+			return nil, fmt.Errorf("unable to read header identifier: %w", err)
+		}
+
+		return nil, readError(headerOffset, "", RecordSignature, err)
 	}
 
 	headerID := binary.LittleEndian.Uint32(headerIDBuf)
 
 	if headerID != fileHeaderSignature {
-		if headerID == directoryHeaderSignature || headerID == directoryEndSignature {
+		if isEndSignature(headerID) {
 			z.localFileEnd = true
 
+			if z.ReadCentralDirectory {
+				if err := z.readCentralDirectory(headerID); err != nil {
+					return nil, err
+				}
+			}
+
 			return nil, io.EOF
 		}
 
-		return nil, zip.ErrFormat
+		return nil, &FormatError{
+			Offset: headerOffset,
+			Record: RecordSignature,
+			Err:    fmt.Errorf("unexpected signature %#08x", headerID),
+		}
 	}
 
-	entry, err := z.readEntry()
+	z.numEntries++
+
+	entry, err := z.readEntry(headerOffset)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read zip file header: %w", err)
+		return nil, err
 	}
 
 	z.curEntry = entry
 
+	if z.ReadCentralDirectory {
+		z.entries = append(z.entries, entry)
+	}
+
 	return entry, nil
 }
 
-func decompressor(method uint16) zip.Decompressor {
-	switch method {
-	case zip.Deflate:
-		return flate.NewReader
-	case zip.Store:
-		return io.NopCloser
+// isEndSignature checks if signature starts a record that follows local entries.
+func isEndSignature(sig uint32) bool {
+	switch sig {
+	case directoryHeaderSignature, directoryEndSignature, directory64EndSignature, directory64LocSignature:
+		return true
 	default:
-		return nil
+		return false
 	}
 }
 
-func readDataDescriptor(r io.Reader, entry *Entry) error {
-	var buf [dataDescriptorLen]byte
+// readDataDescriptor reads data descriptor after entry data,
+// nread is a number of uncompressed bytes that were read for entry of unknown size.
+func readDataDescriptor(entry *Entry, nread uint64) error {
+	r := entry.z.r
+
+	// Compressed data ends where data descriptor starts.
+	compressedSize := uint64(r.n - entry.dataOffset)
+	uncompressedSize := entry.UncompressedSize64
+
+	if entry.unknownSize {
+		uncompressedSize = nread
+	}
+
+	// Descriptor is peeked first to find out its length.
+	buf, err := r.peek(dataDescriptor64Len)
+	if len(buf) < dataDescriptorLen-4 {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return readError(r.n, entry.Name, RecordDataDescriptor, err)
+	}
+
 	// The spec says: "Although not originally assigned a
 	// signature, the value 0x08074b50 has commonly been adopted
 	// as a signature value for the data descriptor record.
@@ -375,53 +620,78 @@ func readDataDescriptor(r io.Reader, entry *Entry) error {
 	// encountered with or without this signature marking data
 	// descriptors and should account for either case when reading
 	// ZIP files to ensure compatibility."
-	//
-	// dataDescriptorLen includes the size of the signature but
-	// first read just those 4 bytes to see if it exists.
-	n, err := io.ReadFull(r, buf[:4])
-	entry.hasReadNum += uint64(n)
+	off := 0
+	if binary.LittleEndian.Uint32(buf) == dataDescriptorSignature {
+		off = 4
+	}
 
-	if err != nil {
-		return err
+	crc := binary.LittleEndian.Uint32(buf[off:])
+	off += 4
+
+	// Zip64 entries have 64-bit sizes in data descriptor, but not all
+	// writers follow the spec, so another width is tried if sizes do not
+	// match the data that was read.
+	widths := []int{4, 8}
+	if entry.zip64 {
+		widths = []int{8, 4}
 	}
 
-	off := 0
-	maybeSig := readBuf(buf[:4])
+	found := false
+
+	for _, w := range widths {
+		if len(buf) < off+2*w {
+			continue
+		}
 
-	if maybeSig.uint32() != dataDescriptorSignature {
-		// No data descriptor signature. Keep these four
-		// bytes.
-		off += 4
-	} else {
-		entry.hasDataDescriptorSignature = true
+		b := readBuf(buf[off : off+2*w])
+
+		var cs, us uint64
+
+		if w == 4 {
+			cs, us = uint64(b.uint32()), uint64(b.uint32())
+		} else {
+			cs, us = b.uint64(), b.uint64()
+		}
+
+		if cs == compressedSize && us == uncompressedSize {
+			off += 2 * w
+			found = true
+
+			break
+		}
 	}
 
-	n, err = io.ReadFull(r, buf[off:12])
-	entry.hasReadNum += uint64(n)
+	if !found {
+		return &FormatError{
+			Offset: r.n,
+			Entry:  entry.Name,
+			Record: RecordDataDescriptor,
+			Err:    fmt.Errorf("sizes do not match %d compressed and %d uncompressed bytes", compressedSize, uncompressedSize),
+		}
+	}
 
-	if err != nil {
-		return err
+	if _, err := io.CopyN(io.Discard, r, int64(off)); err != nil {
+		return readError(r.n, entry.Name, RecordDataDescriptor, err)
 	}
 
 	entry.eof = true
+	entry.CompressedSize64 = compressedSize
+	entry.UncompressedSize64 = uncompressedSize
+	entry.CompressedSize = uint32(min(compressedSize, uint64(^uint32(0))))
+	entry.UncompressedSize = uint32(min(uncompressedSize, uint64(^uint32(0))))
 
-	b := readBuf(buf[:12])
-
-	if entry.CRC32 != 0 && b.uint32() != entry.CRC32 {
-		return zip.ErrChecksum
+	if entry.CRC32 != 0 && crc != entry.CRC32 {
+		return &ChecksumError{Entry: entry.Name, Expected: entry.CRC32, Actual: crc}
 	}
 
-	// The two sizes that follow here can be either 32 bits or 64 bits
-	// but the spec is not very clear on this and different
-	// interpretations has been made causing incompatibilities. We
-	// already have the sizes from the central directory so we can
-	// just ignore these.
+	entry.CRC32 = crc
 
 	return nil
 }
 
 type checksumReader struct {
 	rc    io.ReadCloser
+	src   io.Reader // compressed data
 	hash  hash.Hash32
 	nread uint64 // number of bytes read so far
 	entry *Entry
@@ -436,35 +706,52 @@ func (r *checksumReader) Read(b []byte) (int, error) {
 	n, err := r.rc.Read(b)
 	r.hash.Write(b[:n])
 	r.nread += uint64(n)
-	r.entry.hasReadNum += uint64(n)
+
+	if err1 := r.checkRead(n); err1 != nil {
+		r.err = err1
+
+		return n, err1
+	}
 
 	if err == nil {
 		return n, nil
 	}
 
 	if err == io.EOF {
-		if r.nread != r.entry.UncompressedSize64 {
-			return 0, io.ErrUnexpectedEOF
+		// Size of entry with unknown size is validated with data descriptor.
+		if !r.entry.unknownSize && r.nread != r.entry.UncompressedSize64 {
+			r.err = &FormatError{
+				Offset: r.entry.dataOffset,
+				Entry:  r.entry.Name,
+				Record: RecordFileData,
+				Err:    fmt.Errorf("%w: %d of %d bytes", io.ErrUnexpectedEOF, r.nread, r.entry.UncompressedSize64),
+			}
+
+			return 0, r.err
+		}
+
+		// Decompressor may stop before the end of compressed data, remaining data is
+		// consumed to reach data descriptor and authentication code of encrypted entry.
+		if r.src != nil {
+			if _, err1 := io.Copy(io.Discard, r.src); err1 != nil {
+				r.err = err1
+
+				return n, err1
+			}
 		}
 
 		if r.entry.hasDataDescriptor() {
-			if err1 := readDataDescriptor(r.entry.r, r.entry); err1 != nil {
-				if err1 == io.EOF {
-					err = io.ErrUnexpectedEOF
-				} else {
-					err = err1
-				}
-			} else if r.hash.Sum32() != r.entry.CRC32 {
-				err = zip.ErrChecksum
+			if err1 := readDataDescriptor(r.entry, r.nread); err1 != nil {
+				err = err1
+			} else {
+				err = r.verify(true)
 			}
 		} else {
 			// If there's not a data descriptor, we still compare
 			// the CRC32 of what we've read against the file header
 			// or TOC's CRC32, if it seems like it was set.
 			r.entry.eof = true
-			if r.entry.CRC32 != 0 && r.hash.Sum32() != r.entry.CRC32 {
-				err = zip.ErrChecksum
-			}
+			err = r.verify(r.entry.CRC32 != 0 || r.entry.z.StrictChecksum)
 		}
 	}
 
@@ -473,7 +760,46 @@ func (r *checksumReader) Read(b []byte) (int, error) {
 	return n, err
 }
 
-func (r *checksumReader) Close() error { return r.rc.Close() }
+// Close releases decompressor. Data of unknown size, or data that is verified in strict mode, is read
+// to the end first, because it can not be skipped without decompressor. Error of such read is returned by Next.
+func (r *checksumReader) Close() error {
+	if r.err == nil && (r.entry.unknownSize || r.entry.z.StrictChecksum) {
+		_, _ = io.Copy(io.Discard, r)
+	}
+
+	if r.err == nil {
+		r.err = ErrEntryClosed
+	}
+
+	return r.rc.Close()
+}
+
+// verify checks CRC32 of data that was read to the end, it returns io.EOF for valid data.
+func (r *checksumReader) verify(check bool) error {
+	e := r.entry
+
+	switch {
+	case e.aes != nil && e.aes.version == aesVendorVersion:
+		// AE-2 omits CRC32, data is authenticated by aesReader.
+		e.verified = true
+	case !check:
+	case r.hash.Sum32() != e.CRC32:
+		return &ChecksumError{Entry: e.Name, Expected: e.CRC32, Actual: r.hash.Sum32()}
+	default:
+		e.verified = true
+	}
+
+	return io.EOF
+}
+
+func (e *Entry) extraError(id uint16) error {
+	return &FormatError{
+		Offset: e.headerOffset,
+		Entry:  e.Name,
+		Record: RecordExtraField,
+		Err:    fmt.Errorf("malformed field %#04x", id),
+	}
+}
 
 func msDosTimeToTime(dosDate, dosTime uint16) time.Time {
 	return time.Date(
@@ -1,12 +1,17 @@
 package httpzip_test
 
 import (
+	"archive/zip"
 	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"io"
 	"log"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -89,3 +94,365 @@ func TestNewStreamReader(t *testing.T) {
 		}
 	}
 }
+
+func TestStreamReader_Offset(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := zip.NewWriter(buf)
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		c := []byte("hello " + name)
+		extTime := []byte{0x55, 0x54, 5, 0, 1, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint32(extTime[5:], uint32(modified.Unix()))
+
+		f, err := w.CreateRaw(&zip.FileHeader{
+			Name:               name,
+			Method:             zip.Store,
+			Extra:              extTime,
+			CRC32:              crc32.ChecksumIEEE(c),
+			CompressedSize64:   uint64(len(c)),
+			UncompressedSize64: uint64(len(c)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := f.Write(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sr := httpzip.NewStreamReader(bytes.NewReader(buf.Bytes()))
+
+	for _, f := range zr.File {
+		e, err := sr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dataOffset, err := f.DataOffset()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sr.Offset() != dataOffset {
+			t.Fatalf("unexpected offset %d, %d expected", sr.Offset(), dataOffset)
+		}
+
+		if e.HeaderOffset() != dataOffset-int64(30+len(f.Name)+len(f.Extra)) {
+			t.Fatalf("unexpected header offset %d for %s", e.HeaderOffset(), e.Name)
+		}
+
+		if e.ModifiedSource != httpzip.TimeSourceExtTime || !e.Modified.Equal(modified) {
+			t.Fatalf("unexpected modified time %s (%s)", e.Modified, e.ModifiedSource)
+		}
+	}
+}
+
+func TestStreamReader_Next_dataDescriptor(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := zip.NewWriter(buf)
+	files := map[string]string{}
+	names := []string{"a.txt", "b.txt", "c.txt", "d.txt"}
+
+	for i, name := range names {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := strings.Repeat(fmt.Sprintf("hello %s! ", name), 1000*i)
+		files[name] = c
+
+		if _, err := f.Write([]byte(c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read all, read partially, skip.
+	for _, mode := range []string{"all", "partial", "skip"} {
+		sr := httpzip.NewStreamReader(bytes.NewReader(buf.Bytes()))
+
+		for _, name := range names {
+			e, err := sr.Next()
+			if err != nil {
+				t.Fatal(mode, err)
+			}
+
+			if e.Name != name || !e.HasDataDescriptor() {
+				t.Fatalf("%s: unexpected entry %s", mode, e.Name)
+			}
+
+			switch mode {
+			case "all":
+				rc, err := e.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				c, err := io.ReadAll(rc)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if string(c) != files[name] {
+					t.Fatalf("unexpected contents of %s", name)
+				}
+
+				if e.UncompressedSize64 != uint64(len(c)) || e.CRC32 != crc32.ChecksumIEEE(c) {
+					t.Fatalf("unexpected size or CRC32 of %s", name)
+				}
+			case "partial":
+				rc, err := e.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if _, err := rc.Read(make([]byte, 10)); err != nil && !errors.Is(err, io.EOF) {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		if _, err := sr.Next(); !errors.Is(err, io.EOF) {
+			t.Fatalf("%s: unexpected error: %v", mode, err)
+		}
+	}
+}
+
+func TestStreamReader_Next_storedDataDescriptor(t *testing.T) {
+	rw := httptest.NewRecorder()
+	h := httpzip.NewHandler("archive")
+
+	// Contents imitate data descriptor and following local file header.
+	files := []string{
+		"",
+		"PK\x07\x08",
+		"hello PK\x07\x08\x00\x00\x00\x00\x06\x00\x00\x00\x06\x00\x00\x00PK\x03\x04 world",
+		strings.Repeat("PK\x07\x08", 3000),
+	}
+
+	for i, c := range files {
+		if err := h.AddFile(httpzip.FileSource{
+			Path: fmt.Sprintf("file_%d.txt", i),
+			Size: int64(len(c)),
+			Data: func(w io.Writer) error {
+				_, err := w.Write([]byte(c))
+
+				return err
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h.ServeHTTP(rw, nil)
+
+	for _, skip := range []bool{false, true} {
+		sr := httpzip.NewStreamReader(bytes.NewReader(rw.Body.Bytes()))
+
+		for i, c := range files {
+			e, err := sr.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if e.Name != fmt.Sprintf("file_%d.txt", i) {
+				t.Fatalf("unexpected entry %s", e.Name)
+			}
+
+			if skip {
+				continue
+			}
+
+			rc, err := e.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(res) != c {
+				t.Fatalf("unexpected contents of %s: %q", e.Name, string(res))
+			}
+		}
+
+		if _, err := sr.Next(); !errors.Is(err, io.EOF) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+// zip64Entry builds local file header with Zip64 extra field, deflated data and data descriptor with 64-bit sizes.
+func zip64Entry(t *testing.T, name string, c []byte, knownSize bool) []byte {
+	t.Helper()
+
+	compressed := bytes.NewBuffer(nil)
+
+	fw, err := flate.NewWriter(compressed, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fw.Write(c); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var cs, us uint64
+
+	if knownSize {
+		cs, us = uint64(compressed.Len()), uint64(len(c))
+	}
+
+	b := binary.LittleEndian
+	buf := bytes.NewBuffer(nil)
+	h := make([]byte, 30)
+	b.PutUint32(h, 0x04034b50)
+	b.PutUint16(h[4:], 45)          // Version needed.
+	b.PutUint16(h[6:], 0x8)         // Data descriptor flag.
+	b.PutUint16(h[8:], 8)           // Deflate.
+	b.PutUint32(h[18:], ^uint32(0)) // Compressed size in Zip64 extra.
+	b.PutUint32(h[22:], ^uint32(0)) // Uncompressed size in Zip64 extra.
+	b.PutUint16(h[26:], uint16(len(name)))
+	b.PutUint16(h[28:], 20)
+	buf.Write(h)
+	buf.WriteString(name)
+
+	extra := make([]byte, 20)
+	b.PutUint16(extra, 0x0001)
+	b.PutUint16(extra[2:], 16)
+	b.PutUint64(extra[4:], us)
+	b.PutUint64(extra[12:], cs)
+	buf.Write(extra)
+	buf.Write(compressed.Bytes())
+
+	dd := make([]byte, 24)
+	b.PutUint32(dd, 0x08074b50)
+	b.PutUint32(dd[4:], crc32.ChecksumIEEE(c))
+	b.PutUint64(dd[8:], uint64(compressed.Len()))
+	b.PutUint64(dd[16:], uint64(len(c)))
+	buf.Write(dd)
+
+	return buf.Bytes()
+}
+
+func TestStreamReader_Next_zip64DataDescriptor(t *testing.T) {
+	stream := bytes.NewBuffer(nil)
+	stream.Write(zip64Entry(t, "a.txt", []byte("hello a"), false))
+	stream.Write(zip64Entry(t, "b.txt", []byte("hello b"), true))
+	stream.Write(zip64Entry(t, "c.txt", []byte("hello c"), false))
+	stream.Write([]byte{0x50, 0x4b, 0x06, 0x06}) // Zip64 end of central directory record.
+	stream.Write(make([]byte, 52))
+
+	for _, read := range []bool{true, false} {
+		sr := httpzip.NewStreamReader(bytes.NewReader(stream.Bytes()))
+
+		for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+			e, err := sr.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if e.Name != name || !e.IsZip64() {
+				t.Fatalf("unexpected entry %s", e.Name)
+			}
+
+			if !read {
+				continue
+			}
+
+			rc, err := e.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(c) != "hello "+name[:1] {
+				t.Fatalf("unexpected contents %q", string(c))
+			}
+		}
+
+		if _, err := sr.Next(); !errors.Is(err, io.EOF) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestStreamReader_StrictChecksum(t *testing.T) {
+	// Entry without CRC32, as written by Handler with IgnoreCRC32.
+	buf := bytes.NewBuffer(nil)
+	w := zip.NewWriter(buf)
+
+	f, err := w.CreateRaw(&zip.FileHeader{Name: "a.txt", CompressedSize64: 5, UncompressedSize64: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	noCRC := buf.Bytes()
+
+	sr := httpzip.NewStreamReader(bytes.NewReader(noCRC))
+
+	entries, err := readAll(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entries[0].Verified() {
+		t.Fatal("entry without CRC32 should not be verified")
+	}
+
+	sr = httpzip.NewStreamReader(bytes.NewReader(noCRC))
+	sr.StrictChecksum = true
+
+	var ce *httpzip.ChecksumError
+	if _, err := readAll(sr); !errors.As(err, &ce) || ce.Expected != 0 {
+		t.Fatalf("checksum error expected, got %v", err)
+	}
+
+	// Entries that are skipped are verified in strict mode.
+	sr = httpzip.NewStreamReader(bytes.NewReader(zeroesArchive(t, 100, "a.bin", "b.bin")))
+	sr.StrictChecksum = true
+
+	entries, err = readAll(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range entries {
+		if !e.Verified() {
+			t.Fatalf("%s is not verified", e.Name)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package httpzip
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// DefaultMaxSpoolSize is a default limit of entry of unknown size that is converted to tar.
+const DefaultMaxSpoolSize = 1 << 30
+
+// maxSymlinkSize limits size of symlink target stored as entry data.
+const maxSymlinkSize = 4096
+
+// TarOptions configures conversion of ZIP stream to tar.
+type TarOptions struct {
+	// Select chooses entries to convert, all entries are converted by default.
+	Select WalkOptions
+
+	// Rename returns entry name in tar, entry is skipped if name is empty.
+	Rename func(e *Entry) string
+
+	// FileMode and DirMode are used if entry has no permissions, defaults are 0644 and 0755.
+	FileMode fs.FileMode
+	DirMode  fs.FileMode
+
+	// Tar header needs entry size before data, so entries of unknown size (with data descriptor) are spooled.
+	// Up to SpoolMemory bytes (1 MiB by default) are kept in memory, the rest is written to a temporary file
+	// in SpoolDir (os.TempDir by default).
+	SpoolDir    string
+	SpoolMemory int64
+
+	// MaxSpoolSize limits size of a spooled entry, DefaultMaxSpoolSize is used if zero, negative disables the limit.
+	MaxSpoolSize int64
+}
+
+// WriteTar converts remaining entries to POSIX tar stream in PAX format.
+//
+// Directories, names, permissions, modification and access times, and Unix owner are preserved.
+// Permissions are only available from central directory or Unix extra fields, so entries
+// of a stream mostly have default modes.
+func (z *StreamReader) WriteTar(w io.Writer, opts TarOptions) error {
+	if opts.FileMode == 0 {
+		opts.FileMode = 0o644
+	}
+
+	if opts.DirMode == 0 {
+		opts.DirMode = 0o755
+	}
+
+	if opts.SpoolMemory == 0 {
+		opts.SpoolMemory = 1 << 20
+	}
+
+	if opts.MaxSpoolSize == 0 {
+		opts.MaxSpoolSize = DefaultMaxSpoolSize
+	}
+
+	tw := tar.NewWriter(w)
+	sp := &spool{opts: &opts}
+
+	defer sp.close()
+
+	if err := z.Walk(opts.Select, func(e *Entry) error {
+		return opts.writeEntry(tw, e, sp)
+	}); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// TarReader returns tar stream of remaining entries, see WriteTar.
+//
+// Conversion runs in a goroutine while tar stream is read, it stops with error if reader is closed early.
+func (z *StreamReader) TarReader(opts TarOptions) io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	go func() {
+		pw.CloseWithError(z.WriteTar(pw, opts))
+	}()
+
+	return pr
+}
+
+func (o *TarOptions) writeEntry(tw *tar.Writer, e *Entry, sp *spool) error {
+	name := e.Name
+	if o.Rename != nil {
+		if name = o.Rename(e); name == "" {
+			return nil
+		}
+	}
+
+	md := e.Metadata()
+
+	hdr := &tar.Header{
+		Name:     name,
+		Typeflag: tar.TypeReg,
+		Mode:     int64(o.FileMode.Perm()),
+		ModTime:  e.Modified,
+		Format:   tar.FormatPAX,
+	}
+
+	if ts, ok := md.Time(TimeAccessed); ok {
+		hdr.AccessTime = ts.Time
+	}
+
+	if md.Owner != nil {
+		hdr.Uid = int(md.Owner.UID)
+		hdr.Gid = int(md.Owner.GID)
+	}
+
+	// Permissions are only available from central directory or Unix extra fields.
+	if perm := e.Mode().Perm(); e.ExternalAttrs != 0 && perm != 0 {
+		hdr.Mode = int64(perm)
+	}
+
+	if e.IsDir() {
+		hdr.Typeflag = tar.TypeDir
+
+		if e.ExternalAttrs == 0 || e.Mode().Perm() == 0 {
+			hdr.Mode = int64(o.DirMode.Perm())
+		}
+
+		return tw.WriteHeader(hdr)
+	}
+
+	rc, err := e.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close() //nolint:errcheck // Decompressor close error is irrelevant.
+
+	if e.ExternalAttrs != 0 && e.Mode()&fs.ModeSymlink != 0 {
+		target, err := io.ReadAll(io.LimitReader(rc, maxSymlinkSize))
+		if err != nil {
+			return err
+		}
+
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = string(target)
+
+		return tw.WriteHeader(hdr)
+	}
+
+	if !e.unknownSize {
+		hdr.Size = int64(e.UncompressedSize64)
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		_, err = io.Copy(tw, rc)
+
+		return err
+	}
+
+	if err := sp.reset(e.Name); err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(sp, rc); err != nil {
+		return err
+	}
+
+	hdr.Size = sp.n
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	return sp.copyTo(tw)
+}
+
+// spool keeps entry data of unknown size, beginning in memory and the rest in a temporary file.
+type spool struct {
+	opts  *TarOptions
+	entry string
+	buf   bytes.Buffer
+	f     *os.File
+	n     int64
+}
+
+func (s *spool) reset(entry string) error {
+	s.entry = entry
+	s.buf.Reset()
+	s.n = 0
+
+	if s.f == nil {
+		return nil
+	}
+
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	return s.f.Truncate(0)
+}
+
+func (s *spool) Write(p []byte) (int, error) {
+	if s.opts.MaxSpoolSize > 0 && s.n+int64(len(p)) > s.opts.MaxSpoolSize {
+		return 0, &LimitError{
+			Err:   ErrSpoolTooLarge,
+			Entry: s.entry,
+			Value: uint64(s.n) + uint64(len(p)),
+			Limit: uint64(s.opts.MaxSpoolSize),
+		}
+	}
+
+	written := 0
+
+	if room := s.opts.SpoolMemory - int64(s.buf.Len()); room > 0 {
+		k := int(min(room, int64(len(p))))
+		s.buf.Write(p[:k])
+		p = p[k:]
+		written = k
+	}
+
+	if len(p) > 0 {
+		if s.f == nil {
+			f, err := os.CreateTemp(s.opts.SpoolDir, "httpzip-spool-*")
+			if err != nil {
+				return written, err
+			}
+
+			s.f = f
+		}
+
+		n, err := s.f.Write(p)
+		written += n
+
+		if err != nil {
+			s.n += int64(written)
+
+			return written, err
+		}
+	}
+
+	s.n += int64(written)
+
+	return written, nil
+}
+
+func (s *spool) copyTo(w io.Writer) error {
+	if _, err := w.Write(s.buf.Bytes()); err != nil {
+		return err
+	}
+
+	if rest := s.n - int64(s.buf.Len()); rest > 0 {
+		if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		if _, err := io.CopyN(w, s.f, rest); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *spool) close() {
+	if s.f == nil {
+		return
+	}
+
+	_ = s.f.Close()
+	_ = os.Remove(s.f.Name())
+}
@@ -0,0 +1,356 @@
+package httpzip
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+// ErrSparseFile is returned for sparse tar entries that can not be read by offset.
+var ErrSparseFile = errors.New("sparse tar entry is not supported")
+
+// ErrLinkTarget is returned for tar hard link that does not point to a preceding regular file.
+var ErrLinkTarget = errors.New("hard link target is not found")
+
+// TarSources reads headers of uncompressed tar archive and returns file sources that read data by offset.
+//
+// Regular files, directories and symlinks are converted with their modes and modification times,
+// hard links are converted to regular files with data of their targets, other entries (devices, FIFOs)
+// are skipped. Data is not read while collecting sources, so sources can be added to Handler
+// with exact Content-Length and served many times.
+func TarSources(r io.ReaderAt, size int64) ([]FileSource, error) {
+	sr := io.NewSectionReader(r, 0, size)
+	tr := tar.NewReader(sr)
+
+	var sources []FileSource
+
+	files := map[string]FileSource{}
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return sources, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if isSparse(hdr) {
+			return nil, fmt.Errorf("%w: %s", ErrSparseFile, hdr.Name)
+		}
+
+		if hdr.Typeflag == tar.TypeLink {
+			target, ok := files[hdr.Linkname]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s links to %s", ErrLinkTarget, hdr.Name, hdr.Linkname)
+			}
+
+			sources = append(sources, linkSource(hdr, target))
+
+			continue
+		}
+
+		fs, ok := tarSource(hdr)
+		if !ok {
+			continue
+		}
+
+		if hdr.Typeflag == tar.TypeReg {
+			// Tar reader does not buffer, data starts right after the header.
+			offset, err := sr.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+
+			fs.Data = func(w io.Writer) error {
+				_, err := io.Copy(w, io.NewSectionReader(r, offset, hdr.Size))
+
+				return err
+			}
+
+			files[hdr.Name] = fs
+		}
+
+		sources = append(sources, fs)
+	}
+}
+
+// AddTar adds entries of tar, tar.gz or tar.zst archive, compression is detected by magic bytes.
+//
+// Archive is read twice: first to collect headers and CRC32 for exact Content-Length,
+// and then to copy data while serving. Every served archive reads its own stream, it is reopened
+// to copy data of hard link target again.
+// See TarSources for conversion of entries.
+func (h *Handler) AddTar(open func() (io.ReadCloser, error)) error {
+	rc, err := open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close() //nolint:errcheck // Archive is only read.
+
+	a, err := newTarReader(rc)
+	if err != nil {
+		return err
+	}
+	defer a.Close() //nolint:errcheck // Decompressor close error is irrelevant.
+
+	tr := a.tar
+	ts := &tarStream{open: open}
+
+	// Regular files by name, hard links copy data of their targets.
+	files := map[string]FileSource{}
+
+	for i := 0; ; i++ {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		var fs FileSource
+
+		switch hdr.Typeflag {
+		case tar.TypeLink:
+			target, ok := files[hdr.Linkname]
+			if !ok {
+				return fmt.Errorf("%w: %s links to %s", ErrLinkTarget, hdr.Name, hdr.Linkname)
+			}
+
+			fs = linkSource(hdr, target)
+		case tar.TypeReg:
+			fs, _ = tarSource(hdr)
+
+			c := crc32.NewIEEE()
+			if _, err := io.Copy(c, tr); err != nil {
+				return err
+			}
+
+			e := &tarEntry{stream: ts, index: i, sum: c.Sum32(), name: hdr.Name}
+			fs.CRC32 = e.sum
+			fs.tar = e
+			fs.Data = func(w io.Writer) error {
+				c := &tarCursor{stream: ts}
+				defer c.close()
+
+				return c.copy(e, w)
+			}
+
+			files[hdr.Name] = fs
+		default:
+			var ok bool
+			if fs, ok = tarSource(hdr); !ok {
+				continue
+			}
+		}
+
+		if err := h.AddFile(fs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// linkSource converts tar hard link to a regular file with data of its target.
+func linkSource(hdr *tar.Header, target FileSource) FileSource {
+	target.Path = hdr.Name
+	target.Modified = hdr.ModTime
+
+	if perm := hdr.FileInfo().Mode().Perm(); perm != 0 {
+		target.Mode = perm
+	}
+
+	return target
+}
+
+// tarSource converts tar header to file source, data of symlink is its target.
+func tarSource(hdr *tar.Header) (FileSource, bool) {
+	fs := FileSource{
+		Path:     hdr.Name,
+		Modified: hdr.ModTime,
+		Mode:     hdr.FileInfo().Mode(),
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeReg:
+		fs.Size = hdr.Size
+		fs.Mode = fs.Mode.Perm()
+	case tar.TypeDir:
+		if !strings.HasSuffix(fs.Path, "/") {
+			fs.Path += "/"
+		}
+
+		fs.Data = noData
+	case tar.TypeSymlink:
+		target := []byte(hdr.Linkname)
+		fs.Size = int64(len(target))
+		fs.CRC32 = crc32.ChecksumIEEE(target)
+		fs.Data = func(w io.Writer) error {
+			_, err := w.Write(target)
+
+			return err
+		}
+	default:
+		return fs, false
+	}
+
+	return fs, true
+}
+
+func noData(io.Writer) error {
+	return nil
+}
+
+// isSparse checks if entry data has holes that are not stored in archive.
+func isSparse(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+
+	for k := range hdr.PAXRecords {
+		if strings.HasPrefix(k, "GNU.sparse.") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newTarReader detects compression of tar stream.
+func newTarReader(r io.Reader) (*ArchiveReader, error) {
+	a, err := NewArchiveReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.tar == nil {
+		return nil, fmt.Errorf("%w: %s is not a tar archive", ErrUnsupportedFormat, a.format)
+	}
+
+	return a, nil
+}
+
+// tarStream opens tar archive to copy data of its entries.
+type tarStream struct {
+	open func() (io.ReadCloser, error)
+}
+
+// tarEntry locates data of regular file in tar stream.
+type tarEntry struct {
+	stream *tarStream
+	index  int    // Header index.
+	sum    uint32 // CRC32 of data.
+	name   string
+}
+
+// tarCursor copies data of tar entries in order of their headers, stream is reopened to go back.
+type tarCursor struct {
+	stream *tarStream
+
+	rc   io.ReadCloser
+	a    *ArchiveReader
+	tr   *tar.Reader
+	next int // Index of the next header in stream.
+}
+
+// copy writes data of entry, CRC32 is checked in case archive has changed since headers were read.
+func (t *tarCursor) copy(e *tarEntry, w io.Writer) error {
+	if t.tr == nil || e.index < t.next {
+		if err := t.reopen(); err != nil {
+			return err
+		}
+	}
+
+	for ; t.next <= e.index; t.next++ {
+		if _, err := t.tr.Next(); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+
+			return fmt.Errorf("tar entry %d: %w", e.index, err)
+		}
+	}
+
+	c := crc32.NewIEEE()
+	if _, err := io.Copy(io.MultiWriter(w, c), t.tr); err != nil {
+		return err
+	}
+
+	if actual := c.Sum32(); actual != e.sum {
+		return &ChecksumError{Entry: e.name, Expected: e.sum, Actual: actual}
+	}
+
+	return nil
+}
+
+func (t *tarCursor) reopen() error {
+	t.close()
+
+	rc, err := t.stream.open()
+	if err != nil {
+		return err
+	}
+
+	a, err := newTarReader(rc)
+	if err != nil {
+		_ = rc.Close()
+
+		return err
+	}
+
+	t.rc, t.a, t.tr, t.next = rc, a, a.tar, 0
+
+	return nil
+}
+
+func (t *tarCursor) close() {
+	if t.rc != nil {
+		_ = t.a.Close()
+		_ = t.rc.Close()
+	}
+
+	t.rc, t.a, t.tr = nil, nil, nil
+}
+
+// writePass keeps tar streams of a single archive write, so that concurrent writes do not share them.
+type writePass struct {
+	cursors map[*tarStream]*tarCursor
+}
+
+// source binds data of tar entry to the stream of this write.
+func (p *writePass) source(src FileSource) FileSource {
+	if src.tar == nil {
+		return src
+	}
+
+	c, ok := p.cursors[src.tar.stream]
+	if !ok {
+		if p.cursors == nil {
+			p.cursors = map[*tarStream]*tarCursor{}
+		}
+
+		c = &tarCursor{stream: src.tar.stream}
+		p.cursors[src.tar.stream] = c
+	}
+
+	e := src.tar
+	src.Data = func(w io.Writer) error {
+		return c.copy(e, w)
+	}
+
+	return src
+}
+
+// close closes streams after archive is written.
+func (p *writePass) close() {
+	for _, c := range p.cursors {
+		c.close()
+	}
+}
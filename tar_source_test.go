@@ -0,0 +1,309 @@
+package httpzip_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vearutop/httpzip"
+)
+
+func tarFiles(t *testing.T) []byte {
+	t.Helper()
+
+	buf := bytes.NewBuffer(nil)
+	tw := tar.NewWriter(buf)
+	modified := time.Date(2024, 5, 6, 7, 8, 10, 123456789, time.UTC)
+
+	for _, hdr := range []*tar.Header{
+		{Name: "dir", Typeflag: tar.TypeDir, Mode: 0o750, ModTime: modified, Format: tar.FormatPAX},
+		{Name: "dir/a.sh", Typeflag: tar.TypeReg, Mode: 0o755, Size: 9, ModTime: modified, Format: tar.FormatPAX},
+		{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "a.sh", Mode: 0o777, ModTime: modified},
+		{Name: "dir/hard", Typeflag: tar.TypeLink, Linkname: "dir/a.sh", ModTime: modified},
+		{Name: "b.txt", Typeflag: tar.TypeReg, Mode: 0o644, Size: 5, ModTime: modified},
+	} {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+
+		if hdr.Size > 0 {
+			if _, err := tw.Write(bytes.Repeat([]byte(hdr.Name[len(hdr.Name)-1:]), int(hdr.Size))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func checkTarZip(t *testing.T, rw *httptest.ResponseRecorder) {
+	t.Helper()
+
+	if rw.Header().Get("Content-Length") != strconv.Itoa(rw.Body.Len()) {
+		t.Fatalf("unexpected Content-Length: %s, %d", rw.Header().Get("Content-Length"), rw.Body.Len())
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rw.Body.Bytes()), int64(rw.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		name    string
+		mode    fs.FileMode
+		content string
+	}{
+		{name: "dir/", mode: fs.ModeDir | 0o750},
+		{name: "dir/a.sh", mode: 0o755, content: "hhhhhhhhh"},
+		{name: "dir/link", mode: fs.ModeSymlink | 0o777, content: "a.sh"},
+		{name: "dir/hard", mode: 0o755, content: "hhhhhhhhh"},
+		{name: "b.txt", mode: 0o644, content: "ttttt"},
+	}
+
+	if len(zr.File) != len(expected) {
+		t.Fatalf("unexpected entries: %d", len(zr.File))
+	}
+
+	for i, f := range zr.File {
+		e := expected[i]
+
+		if f.Name != e.name || f.Mode() != e.mode {
+			t.Fatalf("unexpected entry %s: %s", f.Name, f.Mode())
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := io.ReadAll(rc)
+		if err != nil || string(c) != e.content {
+			t.Fatalf("unexpected contents of %s: %q, %v", f.Name, c, err)
+		}
+	}
+}
+
+func TestTarSources(t *testing.T) {
+	archive := tarFiles(t)
+
+	for _, streamable := range []bool{false, true} {
+		sources, err := httpzip.TarSources(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h := httpzip.NewHandler("converted")
+		h.Streamable = streamable
+
+		for _, fs := range sources {
+			if err := h.AddFile(fs); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Sources read data by offset, so handler can be served again.
+		for range 2 {
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, nil)
+
+			checkTarZip(t, rw)
+		}
+	}
+}
+
+func TestHandler_AddTar(t *testing.T) {
+	gz := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(gz)
+	_, _ = gw.Write(tarFiles(t))
+	_ = gw.Close()
+
+	opened := 0
+
+	h := httpzip.NewHandler("converted")
+	h.Streamable = true
+	h.OnError = func(err error) {
+		t.Fatal(err)
+	}
+
+	if err := h.AddTar(func() (io.ReadCloser, error) {
+		opened++
+
+		return io.NopCloser(bytes.NewReader(gz.Bytes())), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, nil)
+
+		checkTarZip(t, rw)
+	}
+
+	// Every request reopens archive to copy data of hard link.
+	if opened != 5 {
+		t.Fatalf("unexpected number of reads: %d", opened)
+	}
+}
+
+type closeCounter struct {
+	io.Reader
+	closed *int
+}
+
+func (c closeCounter) Close() error {
+	*c.closed++
+
+	return nil
+}
+
+func TestHandler_AddTar_closed(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	tw := tar.NewWriter(buf)
+
+	for _, hdr := range []*tar.Header{
+		{Name: "a.txt", Typeflag: tar.TypeReg, Mode: 0o644, Size: 5},
+		{Name: "dir", Typeflag: tar.TypeDir, Mode: 0o755},
+	} {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tw.Write(bytes.Repeat([]byte("a"), int(hdr.Size))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_ = tw.Close()
+
+	opened, closed := 0, 0
+
+	h := httpzip.NewHandler("converted")
+	h.OnError = func(err error) {
+		t.Fatal(err)
+	}
+
+	if err := h.AddTar(func() (io.ReadCloser, error) {
+		opened++
+
+		return closeCounter{Reader: bytes.NewReader(buf.Bytes()), closed: &closed}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, nil)
+
+	// Archive is closed after it is served.
+	if opened != 2 || closed != 2 {
+		t.Fatalf("unexpected number of opened and closed reads: %d, %d", opened, closed)
+	}
+}
+
+func TestHandler_AddTar_concurrent(t *testing.T) {
+	archive := tarFiles(t)
+
+	var opened, closed atomic.Int64
+
+	h := httpzip.NewHandler("converted")
+	h.Streamable = true
+	h.OnError = func(err error) {
+		t.Error(err)
+	}
+
+	if err := h.AddTar(func() (io.ReadCloser, error) {
+		opened.Add(1)
+
+		return closeFunc{Reader: bytes.NewReader(archive), close: func() { closed.Add(1) }}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	responses := make([]*httptest.ResponseRecorder, 8)
+
+	var wg sync.WaitGroup
+
+	for i := range responses {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			url := "/converted.zip"
+			if i%2 == 1 {
+				url = "/converted.tar"
+			}
+
+			responses[i] = httptest.NewRecorder()
+			h.ServeHTTP(responses[i], httptest.NewRequest(http.MethodGet, url, nil))
+		}()
+	}
+
+	wg.Wait()
+
+	for i, rw := range responses {
+		if i%2 == 0 {
+			checkTarZip(t, rw)
+
+			continue
+		}
+
+		if rw.Header().Get("Content-Length") != strconv.Itoa(rw.Body.Len()) ||
+			!bytes.Equal(rw.Body.Bytes(), responses[1].Body.Bytes()) {
+			t.Fatalf("unexpected tar response: %s, %d", rw.Header().Get("Content-Length"), rw.Body.Len())
+		}
+	}
+
+	if opened.Load() != closed.Load() {
+		t.Fatalf("unexpected number of opened and closed reads: %d, %d", opened.Load(), closed.Load())
+	}
+}
+
+type closeFunc struct {
+	io.Reader
+	close func()
+}
+
+func (c closeFunc) Close() error {
+	c.close()
+
+	return nil
+}
+
+func TestTarSources_linkTarget(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	tw := tar.NewWriter(buf)
+
+	if err := tw.WriteHeader(&tar.Header{Name: "hard", Typeflag: tar.TypeLink, Linkname: "missing"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = tw.Close()
+
+	if _, err := httpzip.TarSources(bytes.NewReader(buf.Bytes()), int64(buf.Len())); !errors.Is(err, httpzip.ErrLinkTarget) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	h := httpzip.NewHandler("converted")
+
+	if err := h.AddTar(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	}); !errors.Is(err, httpzip.ErrLinkTarget) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
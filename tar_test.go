@@ -0,0 +1,140 @@
+package httpzip_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/vearutop/httpzip"
+)
+
+func readTar(t *testing.T, r io.Reader) (map[string]*tar.Header, map[string]string) {
+	t.Helper()
+
+	headers := map[string]*tar.Header{}
+	contents := map[string]string{}
+
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		headers[hdr.Name] = hdr
+		contents[hdr.Name] = string(c)
+	}
+
+	return headers, contents
+}
+
+func TestStreamReader_WriteTar(t *testing.T) {
+	archive, contents := mixedArchive(t)
+
+	buf := bytes.NewBuffer(nil)
+	w := zip.NewWriter(buf)
+	modified := time.Date(2024, 5, 6, 7, 8, 10, 0, time.UTC)
+
+	if _, err := w.CreateHeader(&zip.FileHeader{Name: "dir/", Modified: modified}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := w.CreateHeader(&zip.FileHeader{Name: "dir/a.txt", Modified: modified, Method: zip.Deflate})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	headers, _ := readTar(t, httpzip.NewStreamReader(bytes.NewReader(buf.Bytes())).TarReader(httpzip.TarOptions{FileMode: 0o600}))
+
+	if hdr := headers["dir/"]; hdr == nil || hdr.Typeflag != tar.TypeDir || hdr.Mode != 0o755 || !hdr.ModTime.Equal(modified) {
+		t.Fatalf("unexpected directory header: %+v", hdr)
+	}
+
+	if hdr := headers["dir/a.txt"]; hdr == nil || hdr.Typeflag != tar.TypeReg || hdr.Mode != 0o600 || hdr.Size != 5 ||
+		!hdr.ModTime.Equal(modified) {
+		t.Fatalf("unexpected file header: %+v", hdr)
+	}
+
+	// Entries of unknown size are spooled to memory and temporary file.
+	dir := t.TempDir()
+	tarBuf := bytes.NewBuffer(nil)
+
+	err = httpzip.NewStreamReader(bytes.NewReader(archive)).WriteTar(tarBuf, httpzip.TarOptions{
+		SpoolDir:    dir,
+		SpoolMemory: 100,
+		Rename: func(e *httpzip.Entry) string {
+			return "renamed/" + e.Name
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, converted := readTar(t, tarBuf)
+
+	for name, c := range contents {
+		if converted["renamed/"+name] != c {
+			t.Fatalf("unexpected contents of %s", name)
+		}
+	}
+
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("spool file is not removed: %v", files)
+	}
+
+	err = httpzip.NewStreamReader(bytes.NewReader(archive)).WriteTar(io.Discard, httpzip.TarOptions{MaxSpoolSize: 1000})
+
+	var le *httpzip.LimitError
+	if !errors.As(err, &le) || !errors.Is(err, httpzip.ErrSpoolTooLarge) || le.Entry != "deflate-dd.txt" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestProxy_ServeHTTP_tar(t *testing.T) {
+	archive, contents := mixedArchive(t)
+
+	p := httpzip.NewProxy("docs", func(*http.Request) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(archive)), nil
+	})
+	p.Select.Include = []string{"deflate*"}
+	p.Tar = &httpzip.TarOptions{}
+
+	rw := httptest.NewRecorder()
+	p.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rw.Header().Get("Content-Type") != "application/x-tar" ||
+		rw.Header().Get("Content-Disposition") != `attachment; filename="docs.tar"` {
+		t.Fatalf("unexpected headers: %v", rw.Header())
+	}
+
+	_, served := readTar(t, rw.Body)
+
+	if len(served) != 2 || served["deflate.txt"] != contents["deflate.txt"] {
+		t.Fatalf("unexpected entries: %d", len(served))
+	}
+}
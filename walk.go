@@ -0,0 +1,145 @@
+package httpzip
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"iter"
+	"path"
+	"strings"
+)
+
+// All returns iterator over remaining entries, iteration ends after the first error.
+//
+// Entry is only valid until the next iteration.
+func (z *StreamReader) All() iter.Seq2[*Entry, error] {
+	return func(yield func(*Entry, error) bool) {
+		for {
+			e, err := z.Next()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+
+			if err != nil {
+				yield(nil, err)
+
+				return
+			}
+
+			if !yield(e, nil) {
+				return
+			}
+		}
+	}
+}
+
+// WalkOptions selects entries, zero value selects all entries.
+type WalkOptions struct {
+	// Include selects entries that match any of patterns, all entries are selected if empty.
+	// Patterns have path.Match syntax and are matched against full name and base name,
+	// patterns that end with "/*" or "/**" also match nested entries of a directory.
+	Include []string
+
+	// Exclude skips entries that match any of patterns.
+	Exclude []string
+
+	// Filter skips entries if it returns false.
+	Filter func(e *Entry) bool
+
+	// SkipJunk skips macOS metadata: "__MACOSX/" directory and ".DS_Store" files.
+	SkipJunk bool
+}
+
+// Match checks if entry is selected.
+func (o WalkOptions) Match(e *Entry) bool {
+	if o.SkipJunk && isJunk(e.Name) {
+		return false
+	}
+
+	if len(o.Include) > 0 && !MatchGlob(o.Include, e.Name) {
+		return false
+	}
+
+	if MatchGlob(o.Exclude, e.Name) {
+		return false
+	}
+
+	return o.Filter == nil || o.Filter(e)
+}
+
+// Walk calls fn for every selected entry until the end of stream.
+//
+// Entries that are not selected are skipped without opening a decompressor if their size is known.
+// Walk stops early without error if fn returns fs.SkipAll, other errors of fn are returned.
+func (z *StreamReader) Walk(opts WalkOptions, fn func(e *Entry) error) error {
+	for e, err := range z.All() {
+		if err != nil {
+			return err
+		}
+
+		if !opts.Match(e) {
+			continue
+		}
+
+		if err := fn(e); err != nil {
+			if errors.Is(err, fs.SkipAll) {
+				return nil
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MatchGlob checks if any of patterns matches entry name, see WalkOptions.Include for syntax.
+func MatchGlob(patterns []string, name string) bool {
+	name = strings.TrimSuffix(name, "/")
+
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+
+		if ok, _ := path.Match(p, path.Base(name)); ok {
+			return true
+		}
+
+		// Pattern "dir/*" or "dir/**" also matches nested entries of dir.
+		for _, suffix := range []string{"/**", "/*"} {
+			if prefix, ok := strings.CutSuffix(p, suffix); ok {
+				dir := pathPrefix(name, strings.Count(prefix, "/")+1)
+
+				if ok, _ := path.Match(prefix, dir); ok && dir != name {
+					return true
+				}
+
+				break
+			}
+		}
+	}
+
+	return false
+}
+
+// pathPrefix returns first n elements of slash-separated name.
+func pathPrefix(name string, n int) string {
+	i := 0
+
+	for ; n > 0; n-- {
+		j := strings.IndexByte(name[i:], '/')
+		if j < 0 {
+			return name
+		}
+
+		i += j + 1
+	}
+
+	return name[:i-1]
+}
+
+// isJunk checks if entry is macOS metadata.
+func isJunk(name string) bool {
+	return strings.HasPrefix(name, "__MACOSX/") || path.Base(name) == ".DS_Store"
+}
@@ -0,0 +1,118 @@
+package httpzip_test
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"slices"
+	"testing"
+
+	"github.com/vearutop/httpzip"
+)
+
+func TestStreamReader_All(t *testing.T) {
+	sr := httpzip.NewStreamReader(bytes.NewReader(zipFiles(t, "a.txt", "b.txt", "c.txt")))
+
+	var names []string
+
+	for e, err := range sr.All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names = append(names, e.Name)
+
+		if e.Name == "b.txt" {
+			break
+		}
+	}
+
+	if !slices.Equal(names, []string{"a.txt", "b.txt"}) {
+		t.Fatalf("unexpected names: %v", names)
+	}
+
+	// Iteration continues after break.
+	for e, err := range sr.All() {
+		if err != nil || e.Name != "c.txt" {
+			t.Fatalf("unexpected entry: %v, %v", e, err)
+		}
+	}
+
+	truncated := zipFiles(t, "a.txt")[:40]
+
+	var lastErr error
+
+	for _, err := range httpzip.NewStreamReader(bytes.NewReader(truncated)).All() {
+		lastErr = err
+	}
+
+	if lastErr == nil {
+		t.Fatal("error expected")
+	}
+}
+
+func TestStreamReader_Walk(t *testing.T) {
+	archive := zipFiles(t,
+		"docs/a.md", "docs/img/b.png", "docs.txt", "src/main.go",
+		"__MACOSX/docs/._a.md", "docs/.DS_Store",
+	)
+
+	for _, tc := range []struct {
+		name     string
+		opts     httpzip.WalkOptions
+		stop     string
+		expected []string
+	}{
+		{
+			name:     "include dir",
+			opts:     httpzip.WalkOptions{Include: []string{"docs/**"}, SkipJunk: true},
+			expected: []string{"docs/a.md", "docs/img/b.png"},
+		},
+		{
+			name:     "base name",
+			opts:     httpzip.WalkOptions{Include: []string{"*.md"}},
+			expected: []string{"docs/a.md", "__MACOSX/docs/._a.md"},
+		},
+		{
+			name:     "exclude and filter",
+			opts:     httpzip.WalkOptions{Exclude: []string{"*.png"}, Filter: func(e *httpzip.Entry) bool { return e.Name != "src/main.go" }},
+			expected: []string{"docs/a.md", "docs.txt", "__MACOSX/docs/._a.md", "docs/.DS_Store"},
+		},
+		{
+			name:     "stop",
+			opts:     httpzip.WalkOptions{SkipJunk: true},
+			stop:     "docs.txt",
+			expected: []string{"docs/a.md", "docs/img/b.png", "docs.txt"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var names []string
+
+			err := httpzip.NewStreamReader(bytes.NewReader(archive)).Walk(tc.opts, func(e *httpzip.Entry) error {
+				names = append(names, e.Name)
+
+				if e.Name == tc.stop {
+					return fs.SkipAll
+				}
+
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(names, tc.expected) {
+				t.Fatalf("unexpected names: %v", names)
+			}
+		})
+	}
+
+	failed := errors.New("failed")
+
+	err := httpzip.NewStreamReader(bytes.NewReader(archive)).Walk(httpzip.WalkOptions{}, func(*httpzip.Entry) error {
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}